@@ -2,9 +2,14 @@
 package adapter
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -15,37 +20,60 @@ type Config struct {
 	Port     int
 	Socket   string
 
+	// Query parameters of a connection URL passed to the driver as is
+	Params map[string]string
+
+	// TLS
+	SSLMode       string // disable, prefer, require, verify-ca or verify-full. The driver's default if empty.
+	SSLCA         string // CA certificate file to verify the server
+	SSLCert       string // Client certificate file
+	SSLKey        string // Client private key file
+	SSLServerName string // Server name to verify instead of Host
+
 	// Only MySQL
 	MySQLEnableCleartextPlugin bool
+
+	// Only Postgres
+	PostgresSchemas []string // Schemas to dump. All schemas except system ones if empty.
 }
 
 // Abstraction layer for multiple kinds of databases
+// Every method taking a context.Context should stop querying the database once it's cancelled.
 type Database interface {
-	TableNames() ([]string, error)
-	DumpTableDDL(table string) (string, error)
-	Views() ([]string, error)
-	Triggers() ([]string, error)
-	Types() ([]string, error)
+	TableNames(ctx context.Context) ([]string, error)
+	DumpTableDDL(ctx context.Context, table string) (string, error)
+	Views(ctx context.Context) ([]string, error)
+	Triggers(ctx context.Context) ([]string, error)
+	Types(ctx context.Context) ([]string, error)
 	DB() *sql.DB
 	Close() error
 }
 
 // TODO: This should probably be part of the Database interface
-func DumpDDLs(d Database) (string, error) {
+func DumpDDLs(ctx context.Context, d Database) (string, error) {
+	return DumpFilteredDDLs(ctx, d, nil)
+}
+
+// Same as DumpDDLs, but tables, views and types whose names are rejected by the filter are not dumped.
+// Triggers follow their tables.
+func DumpFilteredDDLs(ctx context.Context, d Database, filter func(name string) bool) (string, error) {
 	ddls := []string{}
 
-	typeDDLs, err := d.Types()
+	typeDDLs, err := d.Types(ctx)
 	if err != nil {
 		return "", err
 	}
-	ddls = append(ddls, typeDDLs...)
+	ddls = append(ddls, filterDumpedDDLs(typeDDLs, viewOrTypeName, filter)...)
 
-	tableNames, err := d.TableNames()
+	tableNames, err := d.TableNames(ctx)
 	if err != nil {
 		return "", err
 	}
 	for _, tableName := range tableNames {
-		ddl, err := d.DumpTableDDL(tableName)
+		if filter != nil && !filter(tableName) {
+			continue
+		}
+		ddl, err := d.DumpTableDDL(ctx, tableName)
 		if err != nil {
 			return "", err
 		}
@@ -53,45 +81,301 @@ func DumpDDLs(d Database) (string, error) {
 		ddls = append(ddls, ddl)
 	}
 
-	viewDDLs, err := d.Views()
+	viewDDLs, err := d.Views(ctx)
 	if err != nil {
 		return "", err
 	}
-	ddls = append(ddls, viewDDLs...)
+	ddls = append(ddls, filterDumpedDDLs(viewDDLs, viewOrTypeName, filter)...)
 
-	triggerDDLs, err := d.Triggers()
+	triggerDDLs, err := d.Triggers(ctx)
 	if err != nil {
 		return "", err
 	}
-	ddls = append(ddls, triggerDDLs...)
+	ddls = append(ddls, filterDumpedDDLs(triggerDDLs, triggerTableName, filter)...)
 
 	return strings.Join(ddls, "\n\n"), nil
 }
 
-func RunDDLs(d Database, ddls []string, skipDrop bool, beforeApply string) error {
-	transaction, err := d.DB().Begin()
+var (
+	viewOrTypeName   = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:OR\s+REPLACE\s+)?(?:MATERIALIZED\s+)?(?:VIEW|TYPE)\s+([^\s(]+)`)
+	triggerTableName = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:OR\s+(?:REPLACE|ALTER)\s+)?TRIGGER\s+.*?\sON\s+([^\s(]+)`)
+	quotes           = strings.NewReplacer("`", "", `"`, "", "[", "", "]", "")
+)
+
+// Remove DDLs whose names captured by the regexp are rejected by the filter. DDLs with unknown names are kept.
+func filterDumpedDDLs(ddls []string, name *regexp.Regexp, filter func(string) bool) []string {
+	if filter == nil {
+		return ddls
+	}
+	var filtered []string
+	for _, ddl := range ddls {
+		if match := name.FindStringSubmatch(ddl); match == nil || filter(quotes.Replace(match[1])) {
+			filtered = append(filtered, ddl)
+		}
+	}
+	return filtered
+}
+
+// A statement given to RunDDLs
+type DDL struct {
+	SQL         string
+	Skip        bool   // Just show it as skipped without running it
+	Comment     string // Shown before the statement if not empty
+	Destructive bool   // True if running it may lose data or schema objects
+	// Run instead of SQL in order when the database rejects SQL for its options, e.g. MySQL's ALGORITHM=
+	Fallbacks []string
+	// Run as an external command instead of SQL if not nil, e.g. gh-ost. SQL is its command line to be shown.
+	// The DDLs before it are committed first like NoTransaction.
+	Command []string
+	// Run outside the transaction, e.g. CREATE INDEX CONCURRENTLY. The DDLs before it are committed first.
+	NoTransaction bool
+}
+
+// Return the statement as shown, i.e. SQL terminated by a semicolon or the command line
+func (d DDL) Statement() string {
+	if d.Command != nil {
+		return d.SQL
+	}
+	return d.SQL + ";"
+}
+
+// Implemented by databases which may leave INVALID indexes when building them concurrently fails, e.g. Postgres.
+// Such indexes are not dumped.
+type InvalidIndexDropper interface {
+	// Return DDLs dropping INVALID indexes
+	InvalidIndexDrops(ctx context.Context) ([]InvalidIndexDrop, error)
+}
+
+// A DDL dropping an INVALID index, with the index it drops
+type InvalidIndexDrop struct {
+	Table string // Qualified with a schema
+	Index string
+	SQL   string
+}
+
+// Implemented by databases which can limit how long each DDL waits for locks and runs
+type Timeouter interface {
+	// Return statements setting the timeouts of the session. Zero durations are not set.
+	TimeoutStatements(lockTimeout time.Duration, statementTimeout time.Duration) ([]string, error)
+	// Return true if the error tells that a statement failed to acquire a lock in the lock timeout
+	IsLockTimeout(err error) bool
+	// Return statements to set a savepoint, roll back to it, and release it, which are needed to retry a statement
+	// in a transaction after a lock timeout. Empty if the transaction is usable after the failure.
+	Savepoint(name string) (string, string, string)
+}
+
+// Implemented by databases which can tell sizes of tables, e.g. for online schema change tools
+type TableSizer interface {
+	// Return sizes of data and indexes of tables in bytes
+	TableSizes(ctx context.Context) (map[string]int64, error)
+}
+
+// Implemented by databases which may reject a DDL for its options and need DDL.Fallbacks
+type OptionRejecter interface {
+	// Return true if the error of a DDL tells that its options are not supported for the change
+	RejectsOptions(err error) bool
+}
+
+// Asked after showing each DDL which is not skipped and before running it, e.g. by --interactive.
+// The DDL is skipped if it returns false, and RunDDLs fails if it returns an error.
+type Confirm func(ddl DDL) (bool, error)
+
+// How RunDDLs runs DDLs
+type RunOptions struct {
+	BeforeApply   string  // Executed before the DDLs in the same session
+	NoTransaction bool    // Run each DDL in autocommit mode instead of a single transaction
+	Confirm       Confirm // Asked before running each DDL if not nil
+	// Set before each DDL if not zero. The database must implement Timeouter.
+	LockTimeout      time.Duration
+	StatementTimeout time.Duration
+	// Retry a DDL failing by LockTimeout up to this count, waiting RetryBackoff doubled for each retry
+	LockRetries  int
+	RetryBackoff time.Duration
+}
+
+// Returned by RunDDLs when a DDL fails, telling which DDLs were applied
+type RunError struct {
+	Err        error
+	Failed     DDL   // The failed DDL, which is BeforeApply or empty if the commit failed
+	Applied    []DDL // DDLs applied before the failure
+	RolledBack bool  // True if the transaction was rolled back and Applied is empty
+}
+
+func (e *RunError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+func RunDDLs(ctx context.Context, d Database, ddls []DDL, options RunOptions, out io.Writer) error {
+	// BeforeApply and DDLs share the session even without a transaction
+	conn, err := d.DB().Conn(ctx)
 	if err != nil {
 		return err
 	}
-	fmt.Println("-- Apply --")
-	if len(beforeApply) > 0 {
-		fmt.Println(beforeApply)
-		if _, err := transaction.Exec(beforeApply); err != nil {
-			transaction.Rollback()
+	defer conn.Close()
+
+	var transaction *sql.Tx
+	var execer interface {
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	} = conn
+	if !options.NoTransaction {
+		if transaction, err = conn.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		execer = transaction
+	}
+
+	timeouter, _ := d.(Timeouter)
+	var timeouts []string
+	if options.LockTimeout > 0 || options.StatementTimeout > 0 || options.LockRetries > 0 {
+		if timeouter == nil {
+			return fmt.Errorf("lock and statement timeouts are not supported by the database")
+		}
+		if timeouts, err = timeouter.TimeoutStatements(options.LockTimeout, options.StatementTimeout); err != nil {
 			return err
 		}
 	}
+	// Execute a statement after setting the timeouts, and retry it on lock timeouts
+	execute := func(sql string) error {
+		backoff := options.RetryBackoff
+		for retry := 0; ; retry++ {
+			for _, timeout := range timeouts {
+				if _, err := execer.ExecContext(ctx, timeout); err != nil {
+					return err
+				}
+			}
+			var savepoint, rollback, release string
+			if transaction != nil && options.LockRetries > 0 {
+				savepoint, rollback, release = timeouter.Savepoint("sqldef_retry")
+			}
+			if savepoint != "" {
+				if _, err := execer.ExecContext(ctx, savepoint); err != nil {
+					return err
+				}
+			}
+
+			_, err := execer.ExecContext(ctx, sql)
+			if err == nil && release != "" {
+				_, err = execer.ExecContext(ctx, release) // not to stack a savepoint per DDL
+				return err
+			}
+			if err == nil || retry >= options.LockRetries || !timeouter.IsLockTimeout(err) {
+				return err
+			}
+			if rollback != "" {
+				if _, err := execer.ExecContext(ctx, rollback); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(out, "-- Lock timeout: %s. Retrying in %s (%d/%d) --\n", err, backoff, retry+1, options.LockRetries)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+	}
+
+	var applied []DDL
+	committed := 0  // DDLs in applied which were committed before the current transaction
+	reopen := false // True if the transaction was committed to run a DDL outside it, and is begun again when needed
+	fail := func(ddl DDL, err error) error {
+		if transaction != nil {
+			transaction.Rollback()
+			return &RunError{Err: err, Failed: ddl, Applied: applied[:committed], RolledBack: committed == 0}
+		}
+		return &RunError{Err: err, Failed: ddl, Applied: applied}
+	}
+
+	fmt.Fprintln(out, "-- Apply --")
+	if len(options.BeforeApply) > 0 {
+		fmt.Fprintln(out, options.BeforeApply)
+		if _, err := execer.ExecContext(ctx, options.BeforeApply); err != nil {
+			return fail(DDL{SQL: options.BeforeApply}, err)
+		}
+	}
 	for _, ddl := range ddls {
-		if skipDrop && strings.Contains(ddl, "DROP") {
-			fmt.Printf("-- Skipped: %s;\n", ddl)
+		if len(ddl.Comment) > 0 {
+			fmt.Fprintf(out, "-- %s\n", ddl.Comment)
+		}
+		if ddl.Skip {
+			fmt.Fprintf(out, "-- Skipped: %s\n", ddl.Statement())
 			continue
 		}
-		fmt.Printf("%s;\n", ddl)
-		if _, err := transaction.Exec(ddl); err != nil {
-			transaction.Rollback()
-			return err
+		fmt.Fprintln(out, ddl.Statement())
+		if options.Confirm != nil {
+			ok, err := options.Confirm(ddl)
+			if err != nil {
+				return fail(ddl, err)
+			}
+			if !ok {
+				fmt.Fprintln(out, "-- Skipped --")
+				continue
+			}
+		}
+		if ddl.NoTransaction || ddl.Command != nil {
+			// Commit the DDLs so far, since the DDL or the command can't see or join the transaction
+			if transaction != nil {
+				if err := transaction.Commit(); err != nil {
+					return &RunError{Err: fmt.Errorf("failed to commit: %w", err), Applied: applied[:committed], RolledBack: committed == 0}
+				}
+				transaction, execer = nil, conn
+				reopen = true
+			}
+			if ddl.Command != nil {
+				err = runCommand(ctx, ddl.Command, out)
+			} else {
+				err = execute(ddl.SQL)
+			}
+			if err != nil {
+				return fail(ddl, err)
+			}
+			applied = append(applied, ddl)
+			committed = len(applied)
+			continue
+		}
+		if reopen {
+			if transaction, err = conn.BeginTx(ctx, nil); err != nil {
+				return &RunError{Err: fmt.Errorf("failed to begin a transaction: %w", err), Failed: ddl, Applied: applied}
+			}
+			execer = transaction
+			reopen = false
+		}
+		err := execute(ddl.SQL)
+		for _, fallback := range ddl.Fallbacks {
+			if rejecter, ok := d.(OptionRejecter); err == nil || !ok || !rejecter.RejectsOptions(err) {
+				break
+			}
+			fmt.Fprintf(out, "-- Rejected: %s --\n", err)
+			fmt.Fprintf(out, "%s;\n", fallback)
+			ddl.SQL = fallback
+			err = execute(ddl.SQL)
 		}
+		if err != nil {
+			return fail(ddl, err)
+		}
+		applied = append(applied, ddl)
+	}
+
+	if transaction != nil {
+		if err := transaction.Commit(); err != nil {
+			return &RunError{Err: fmt.Errorf("failed to commit: %w", err), Applied: applied[:committed], RolledBack: committed == 0}
+		}
+	}
+	return nil
+}
+
+// Run the command of DDL.Command, writing its stdout and stderr to out
+func runCommand(ctx context.Context, command []string, out io.Writer) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", command[0], err)
 	}
-	transaction.Commit()
 	return nil
 }
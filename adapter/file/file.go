@@ -1,6 +1,7 @@
 package file
 
 import (
+	"context"
 	"database/sql"
 	"github.com/k0kubun/sqldef"
 )
@@ -16,23 +17,24 @@ func NewDatabase(file string) FileDatabase {
 	}
 }
 
-func (f FileDatabase) TableNames() ([]string, error) {
+func (f FileDatabase) TableNames(ctx context.Context) ([]string, error) {
 	return []string{f.file}, nil
 }
 
-func (f FileDatabase) DumpTableDDL(file string) (string, error) {
-	return sqldef.ReadFile(file)
+func (f FileDatabase) DumpTableDDL(ctx context.Context, file string) (string, error) {
+	sql, _, err := sqldef.ReadFiles(file)
+	return sql, err
 }
 
-func (f FileDatabase) Views() ([]string, error) {
+func (f FileDatabase) Views(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
-func (f FileDatabase) Triggers() ([]string, error) {
+func (f FileDatabase) Triggers(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
-func (f FileDatabase) Types() ([]string, error) {
+func (f FileDatabase) Types(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
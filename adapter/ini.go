@@ -0,0 +1,44 @@
+package adapter
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Parse an INI file such as ~/.my.cnf or pg_service.conf into values of each group.
+// A key without a value, e.g. `skip-ssl`, has an empty value. Directives like `!include` are ignored.
+func ReadINIFile(path string) (map[string]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	groups := map[string]map[string]string{}
+	group := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value := line, ""
+		if i := strings.Index(line, "="); i >= 0 {
+			key, value = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if groups[group] == nil {
+			groups[group] = map[string]string{}
+		}
+		groups[group][key] = value
+	}
+	return groups, scanner.Err()
+}
@@ -1,15 +1,18 @@
 package mssql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	_ "github.com/denisenkom/go-mssqldb"
+	mssql "github.com/denisenkom/go-mssqldb"
 	"github.com/k0kubun/sqldef/adapter"
 	"github.com/k0kubun/sqldef/sqlparser"
 )
@@ -39,7 +42,11 @@ type MssqlDatabase struct {
 }
 
 func NewDatabase(config adapter.Config) (adapter.Database, error) {
-	db, err := sql.Open("sqlserver", mssqlBuildDSN(config))
+	dsn, err := mssqlBuildDSN(config)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlserver", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -50,8 +57,8 @@ func NewDatabase(config adapter.Config) (adapter.Database, error) {
 	}, nil
 }
 
-func (d *MssqlDatabase) TableNames() ([]string, error) {
-	rows, err := d.db.Query(
+func (d *MssqlDatabase) TableNames(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx,
 		`select schema_name(schema_id) as table_schema, name from sys.objects where type = 'U' ORDER BY sys.objects.name;`,
 	)
 	if err != nil {
@@ -74,7 +81,7 @@ func (d *MssqlDatabase) TableNames() ([]string, error) {
 	// so try our bests and adds cyclic dependency tables later
 	foreignTableMap := make(map[string][]string)
 	for _, tableName := range tables {
-		_, foreignTableNames, err := d.getForeignDefs(tableName)
+		_, foreignTableNames, err := d.getForeignDefs(ctx, tableName)
 		if err != nil {
 			return nil, err
 		}
@@ -115,16 +122,16 @@ func (d *MssqlDatabase) TableNames() ([]string, error) {
 	return dependencyOrderedTables, nil
 }
 
-func (d *MssqlDatabase) DumpTableDDL(table string) (string, error) {
-	cols, err := d.getColumns(table)
+func (d *MssqlDatabase) DumpTableDDL(ctx context.Context, table string) (string, error) {
+	cols, err := d.getColumns(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	indexDefs, err := d.getIndexDefs(table)
+	indexDefs, err := d.getIndexDefs(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	foreignDefs, _, err := d.getForeignDefs(table)
+	foreignDefs, _, err := d.getForeignDefs(ctx, table)
 	if err != nil {
 		return "", err
 	}
@@ -316,7 +323,7 @@ type check struct {
 	NotForReplication bool
 }
 
-func (d *MssqlDatabase) getColumns(table string) ([]column, error) {
+func (d *MssqlDatabase) getColumns(ctx context.Context, table string) ([]column, error) {
 	schema, table := splitTableName(table)
 	query := fmt.Sprintf(`SELECT
 	c.name,
@@ -340,9 +347,9 @@ LEFT JOIN sys.check_constraints cc WITH(NOLOCK) ON c.[object_id] = cc.parent_obj
 LEFT JOIN sys.identity_columns ic WITH(NOLOCK) ON c.[object_id] = ic.[object_id] AND ic.[column_id] = c.[column_id]
 WHERE c.[object_id] = OBJECT_ID('%s.%s', 'U')`, schema, table)
 
-	rows, err := d.db.Query(query)
+	rows, err := d.db.QueryContext(ctx, query)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -400,7 +407,7 @@ type indexOption struct {
 	value string
 }
 
-func (d *MssqlDatabase) getIndexDefs(table string) ([]*indexDef, error) {
+func (d *MssqlDatabase) getIndexDefs(ctx context.Context, table string) ([]*indexDef, error) {
 	schema, table := splitTableName(table)
 	query := fmt.Sprintf(`SELECT
 	ind.name AS index_name,
@@ -418,7 +425,7 @@ FROM sys.indexes ind
 INNER JOIN sys.stats st ON ind.object_id = st.object_id AND ind.index_id = st.stats_id
 WHERE ind.object_id = OBJECT_ID('[%s].[%s]')`, schema, table)
 
-	rows, err := d.db.Query(query)
+	rows, err := d.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -461,7 +468,7 @@ FROM sys.indexes ind
 INNER JOIN sys.index_columns ic ON ind.object_id = ic.object_id AND ind.index_id = ic.index_id
 WHERE ind.object_id = OBJECT_ID('[%s].[%s]')`, schema, table)
 
-	rows, err = d.db.Query(query)
+	rows, err = d.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -500,7 +507,7 @@ WHERE ind.object_id = OBJECT_ID('[%s].[%s]')`, schema, table)
 	return indexDefs, nil
 }
 
-func (d *MssqlDatabase) getForeignDefs(table string) ([]string, []string, error) {
+func (d *MssqlDatabase) getForeignDefs(ctx context.Context, table string) ([]string, []string, error) {
 	schema, table := splitTableName(table)
 	query := fmt.Sprintf(`SELECT
 	f.name,
@@ -513,7 +520,7 @@ func (d *MssqlDatabase) getForeignDefs(table string) ([]string, []string, error)
 FROM sys.foreign_keys f INNER JOIN sys.foreign_key_columns fc ON f.OBJECT_ID = fc.constraint_object_id
 WHERE f.parent_object_id = OBJECT_ID('[%s].[%s]')`, schema, table)
 
-	rows, err := d.db.Query(query)
+	rows, err := d.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -556,7 +563,7 @@ var (
 	spaces          = regexp.MustCompile(`[ ]+`)
 )
 
-func (d *MssqlDatabase) Views() ([]string, error) {
+func (d *MssqlDatabase) Views(ctx context.Context) ([]string, error) {
 	// azure sql server has some system view only distinguished by 'is_ms_shipped = 0' check
 	const sql = `SELECT
 	sys.views.name as name,
@@ -570,7 +577,7 @@ INNER JOIN sys.sql_modules
 	ON sys.sql_modules.object_id = sys.objects.object_id
 `
 
-	rows, err := d.db.Query(sql)
+	rows, err := d.db.QueryContext(ctx, sql)
 	if err != nil {
 		return nil, err
 	}
@@ -591,13 +598,13 @@ INNER JOIN sys.sql_modules
 	return ddls, nil
 }
 
-func (d *MssqlDatabase) Triggers() ([]string, error) {
+func (d *MssqlDatabase) Triggers(ctx context.Context) ([]string, error) {
 	query := `SELECT
 	s.definition
 FROM sys.triggers tr
 INNER JOIN sys.all_sql_modules s ON s.object_id = tr.object_id`
 
-	rows, err := d.db.Query(query)
+	rows, err := d.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -616,10 +623,35 @@ INNER JOIN sys.all_sql_modules s ON s.object_id = tr.object_id`
 	return triggers, nil
 }
 
-func (d *MssqlDatabase) Types() ([]string, error) {
+func (d *MssqlDatabase) Types(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
+// LOCK_TIMEOUT in milliseconds. SQL Server has no timeout of statements in the session.
+func (d *MssqlDatabase) TimeoutStatements(lockTimeout time.Duration, statementTimeout time.Duration) ([]string, error) {
+	if statementTimeout > 0 {
+		return nil, fmt.Errorf("statement timeout is not supported by SQL Server")
+	}
+	var statements []string
+	if lockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("SET LOCK_TIMEOUT %d", (lockTimeout+time.Millisecond-1)/time.Millisecond))
+	}
+	return statements, nil
+}
+
+// Error number of "Lock request time out period exceeded"
+const lockRequestTimeout = 1222
+
+func (d *MssqlDatabase) IsLockTimeout(err error) bool {
+	var mssqlErr mssql.Error
+	return errors.As(err, &mssqlErr) && mssqlErr.Number == lockRequestTimeout
+}
+
+// The transaction is usable after a lock timeout unless XACT_ABORT is ON
+func (d *MssqlDatabase) Savepoint(name string) (string, string, string) {
+	return "", "", ""
+}
+
 func (d *MssqlDatabase) DB() *sql.DB {
 	return d.db
 }
@@ -628,17 +660,44 @@ func (d *MssqlDatabase) Close() error {
 	return d.db.Close()
 }
 
-func mssqlBuildDSN(config adapter.Config) string {
+func mssqlBuildDSN(config adapter.Config) (string, error) {
 	query := url.Values{}
 	query.Add("database", config.DbName)
 
+	if config.SSLCert != "" || config.SSLKey != "" {
+		return "", fmt.Errorf("SSL client certificates are not supported by the SQL Server driver")
+	}
+	switch adapter.NormalizeSSLMode(config.SSLMode) {
+	case "":
+	case "disable":
+		query.Add("encrypt", "disable")
+	case "require":
+		query.Add("encrypt", "true")
+		query.Add("TrustServerCertificate", "true")
+	case "verify-ca", "verify-full": // The driver always verifies the host name too
+		query.Add("encrypt", "true")
+		query.Add("TrustServerCertificate", "false")
+	default:
+		return "", fmt.Errorf("unsupported SSL mode '%s' (expected one of: disable, require, verify-ca, verify-full)", config.SSLMode)
+	}
+	if config.SSLCA != "" {
+		query.Add("certificate", config.SSLCA)
+	}
+	if config.SSLServerName != "" {
+		query.Add("hostNameInCertificate", config.SSLServerName)
+	}
+
+	for key, value := range config.Params {
+		query.Add(key, value)
+	}
+
 	u := &url.URL{
 		Scheme:   "sqlserver",
 		User:     url.UserPassword(config.User, config.Password),
 		Host:     fmt.Sprintf("%s:%d", config.Host, config.Port),
 		RawQuery: query.Encode(),
 	}
-	return u.String()
+	return u.String(), nil
 }
 
 func splitTableName(table string) (string, string) {
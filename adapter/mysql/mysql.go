@@ -1,8 +1,14 @@
 package mysql
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"time"
 
 	driver "github.com/go-sql-driver/mysql"
 	"github.com/k0kubun/sqldef/adapter"
@@ -14,7 +20,11 @@ type MysqlDatabase struct {
 }
 
 func NewDatabase(config adapter.Config) (adapter.Database, error) {
-	db, err := sql.Open("mysql", mysqlBuildDSN(config))
+	dsn, err := mysqlBuildDSN(config)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -25,8 +35,8 @@ func NewDatabase(config adapter.Config) (adapter.Database, error) {
 	}, nil
 }
 
-func (d *MysqlDatabase) TableNames() ([]string, error) {
-	rows, err := d.db.Query("show full tables where Table_Type != 'VIEW'")
+func (d *MysqlDatabase) TableNames(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "show full tables where Table_Type != 'VIEW'")
 	if err != nil {
 		return nil, err
 	}
@@ -44,11 +54,11 @@ func (d *MysqlDatabase) TableNames() ([]string, error) {
 	return tables, nil
 }
 
-func (d *MysqlDatabase) DumpTableDDL(table string) (string, error) {
+func (d *MysqlDatabase) DumpTableDDL(ctx context.Context, table string) (string, error) {
 	var ddl string
 	sql := fmt.Sprintf("show create table `%s`;", table) // TODO: escape table name
 
-	err := d.db.QueryRow(sql).Scan(&table, &ddl)
+	err := d.db.QueryRowContext(ctx, sql).Scan(&table, &ddl)
 	if err != nil {
 		return "", err
 	}
@@ -56,8 +66,8 @@ func (d *MysqlDatabase) DumpTableDDL(table string) (string, error) {
 	return ddl + ";", nil
 }
 
-func (d *MysqlDatabase) Views() ([]string, error) {
-	rows, err := d.db.Query("show full tables where TABLE_TYPE = 'VIEW'")
+func (d *MysqlDatabase) Views(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "show full tables where TABLE_TYPE = 'VIEW'")
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +80,7 @@ func (d *MysqlDatabase) Views() ([]string, error) {
 			return nil, err
 		}
 		query := fmt.Sprintf("select VIEW_DEFINITION from INFORMATION_SCHEMA.VIEWS where TABLE_SCHEMA = '%s' AND TABLE_NAME = '%s';", d.config.DbName, viewName)
-		if err = d.db.QueryRow(query).Scan(&definition); err != nil {
+		if err = d.db.QueryRowContext(ctx, query).Scan(&definition); err != nil {
 			return nil, err
 		}
 		ddls = append(ddls, fmt.Sprintf("CREATE VIEW %s AS %s;", viewName, definition))
@@ -78,8 +88,8 @@ func (d *MysqlDatabase) Views() ([]string, error) {
 	return ddls, nil
 }
 
-func (d *MysqlDatabase) Triggers() ([]string, error) {
-	rows, err := d.db.Query("show triggers")
+func (d *MysqlDatabase) Triggers(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "show triggers")
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +107,7 @@ func (d *MysqlDatabase) Triggers() ([]string, error) {
 	return ddls, nil
 }
 
-func (d *MysqlDatabase) Types() ([]string, error) {
+func (d *MysqlDatabase) Types(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
@@ -109,7 +119,70 @@ func (d *MysqlDatabase) Close() error {
 	return d.db.Close()
 }
 
-func mysqlBuildDSN(config adapter.Config) string {
+// Error numbers of ER_ALTER_OPERATION_NOT_SUPPORTED and ER_ALTER_OPERATION_NOT_SUPPORTED_REASON
+var alterNotSupported = []uint16{1845, 1846}
+
+// True if MySQL rejects ALGORITHM= or LOCK= of ALTER TABLE, e.g. ALGORITHM=INPLACE to change a column type
+func (d *MysqlDatabase) RejectsOptions(err error) bool {
+	var mysqlErr *driver.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	for _, number := range alterNotSupported {
+		if mysqlErr.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+// lock_wait_timeout in seconds. max_execution_time applies only to SELECT, so it can't be a statement timeout of DDLs.
+func (d *MysqlDatabase) TimeoutStatements(lockTimeout time.Duration, statementTimeout time.Duration) ([]string, error) {
+	if statementTimeout > 0 {
+		return nil, fmt.Errorf("statement timeout is not supported by MySQL")
+	}
+	var statements []string
+	if lockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("SET SESSION lock_wait_timeout = %d", (lockTimeout+time.Second-1)/time.Second))
+	}
+	return statements, nil
+}
+
+// Error number of ER_LOCK_WAIT_TIMEOUT
+const lockWaitTimeout = 1205
+
+func (d *MysqlDatabase) IsLockTimeout(err error) bool {
+	var mysqlErr *driver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == lockWaitTimeout
+}
+
+// DDLs commit the transaction implicitly, so savepoints don't survive them
+func (d *MysqlDatabase) Savepoint(name string) (string, string, string) {
+	return "", "", ""
+}
+
+// Sizes of data and indexes estimated by information_schema.tables
+func (d *MysqlDatabase) TableSizes(ctx context.Context) (map[string]int64, error) {
+	rows, err := d.db.QueryContext(ctx, "select table_name, coalesce(data_length, 0) + coalesce(index_length, 0) "+
+		"from information_schema.tables where table_schema = database() and table_type = 'BASE TABLE'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := map[string]int64{}
+	for rows.Next() {
+		var table string
+		var size int64
+		if err := rows.Scan(&table, &size); err != nil {
+			return nil, err
+		}
+		sizes[table] = size
+	}
+	return sizes, rows.Err()
+}
+
+func mysqlBuildDSN(config adapter.Config) (string, error) {
 	c := driver.NewConfig()
 	c.User = config.User
 	c.Passwd = config.Password
@@ -122,5 +195,92 @@ func mysqlBuildDSN(config adapter.Config) string {
 		c.Net = "unix"
 		c.Addr = config.Socket
 	}
-	return c.FormatDSN()
+	c.Params = config.Params
+
+	mode := adapter.NormalizeSSLMode(config.SSLMode)
+	if mode == "" && (config.SSLCA != "" || config.SSLCert != "") {
+		mode = "require"
+	}
+	switch mode {
+	case "":
+	case "disable":
+		c.TLSConfig = "false"
+	case "prefer":
+		c.TLSConfig = "preferred"
+	case "require", "verify-ca", "verify-full":
+		tlsConfig, err := mysqlBuildTLSConfig(config, mode)
+		if err != nil {
+			return "", err
+		}
+		if err := driver.RegisterTLSConfig(mysqlTLSConfigName, tlsConfig); err != nil {
+			return "", err
+		}
+		c.TLSConfig = mysqlTLSConfigName
+	default:
+		return "", fmt.Errorf("unsupported SSL mode '%s' (expected one of: disable, prefer, require, verify-ca, verify-full)", config.SSLMode)
+	}
+	return c.FormatDSN(), nil
+}
+
+const mysqlTLSConfigName = "sqldef"
+
+func mysqlBuildTLSConfig(config adapter.Config, mode string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: config.SSLServerName,
+	}
+	if tlsConfig.ServerName == "" && config.Socket == "" {
+		tlsConfig.ServerName = config.Host
+	}
+
+	if config.SSLCA != "" {
+		pem, err := ioutil.ReadFile(config.SSLCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate is found in '%s'", config.SSLCA)
+		}
+	}
+
+	if config.SSLCert != "" || config.SSLKey != "" {
+		cert, err := tls.LoadX509KeyPair(config.SSLCert, config.SSLKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// Like libpq, "require" verifies the certificate chain if a CA is given
+	if mode == "verify-ca" || (mode == "require" && config.SSLCA != "") {
+		// Verify the certificate chain without the host name
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, tlsConfig.RootCAs)
+		}
+	} else if mode == "require" {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	var leaf *x509.Certificate
+	for i, rawCert := range rawCerts {
+		cert, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if leaf == nil {
+		return fmt.Errorf("no server certificate is given")
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
 }
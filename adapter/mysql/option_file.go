@@ -0,0 +1,35 @@
+package mysql
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/k0kubun/sqldef/adapter"
+)
+
+// Option file read when --defaults-file is not given
+func DefaultOptionFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".my.cnf")
+}
+
+// Read options in [client] and [mysqldef] groups of a MySQL option file such as ~/.my.cnf.
+// Like the mysql command, underscores in option names are the same as dashes.
+func ReadOptionFile(path string) (map[string]string, error) {
+	groups, err := adapter.ReadINIFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	options := map[string]string{}
+	for _, group := range []string{"client", "mysqldef"} { // the latter takes precedence
+		for key, value := range groups[group] {
+			options[strings.ReplaceAll(key, "_", "-")] = value
+		}
+	}
+	return options, nil
+}
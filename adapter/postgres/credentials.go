@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/k0kubun/sqldef/adapter"
+)
+
+// Read parameters of a service in $PGSERVICEFILE or ~/.pg_service.conf, and then $PGSYSCONFDIR/pg_service.conf.
+// Keys are libpq's ones, e.g. host, port, dbname, user and sslmode.
+func ReadService(name string) (map[string]string, error) {
+	var paths []string
+	if path := os.Getenv("PGSERVICEFILE"); path != "" {
+		paths = append(paths, path)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".pg_service.conf"))
+	}
+	if dir := os.Getenv("PGSYSCONFDIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "pg_service.conf"))
+	}
+
+	for _, path := range paths {
+		groups, err := adapter.ReadINIFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if params, ok := groups[name]; ok {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("service '%s' is not found in: %s", name, strings.Join(paths, ", "))
+}
+
+// Find the password for the config in $PGPASSFILE or ~/.pgpass, whose lines are
+// `hostname:port:database:username:password` and fields may be `*` to match anything.
+func lookupPgpass(config adapter.Config) (string, error) {
+	path := os.Getenv("PGPASSFILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".pgpass")
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// Ignore the file with a warning if others can read it, like libpq
+	if stat, err := file.Stat(); err != nil {
+		return "", err
+	} else if stat.Mode().Perm()&0077 != 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: password file \"%s\" has group or world access; permissions should be u=rw (0600) or less\n", path)
+		return "", nil
+	}
+
+	host := config.Host
+	if config.Socket != "" {
+		host = "localhost" // libpq's name of Unix-domain socket connections
+	}
+	fields := []string{host, strconv.Itoa(config.Port), config.DbName, config.User}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry := splitPgpassLine(line)
+		if len(entry) != 5 {
+			continue
+		}
+		if matchPgpassFields(entry[:4], fields) {
+			return entry[4], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// Split a line by unescaped colons, unescaping `\:` and `\\`
+func splitPgpassLine(line string) []string {
+	var fields []string
+	var field strings.Builder
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			field.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteRune(c)
+		}
+	}
+	return append(fields, field.String())
+}
+
+func matchPgpassFields(patterns []string, fields []string) bool {
+	for i, pattern := range patterns {
+		if pattern != "*" && pattern != fields[i] {
+			return false
+		}
+	}
+	return true
+}
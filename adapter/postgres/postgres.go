@@ -1,16 +1,19 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/url"
-	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/k0kubun/sqldef/adapter"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const indent = "    "
@@ -21,6 +24,17 @@ type PostgresDatabase struct {
 }
 
 func NewDatabase(config adapter.Config) (adapter.Database, error) {
+	if config.SSLServerName != "" {
+		return nil, fmt.Errorf("SSL server name is not supported by the PostgreSQL driver")
+	}
+	if config.Password == "" {
+		password, err := lookupPgpass(config)
+		if err != nil {
+			return nil, err
+		}
+		config.Password = password
+	}
+
 	db, err := sql.Open("postgres", postgresBuildDSN(config))
 	if err != nil {
 		return nil, err
@@ -32,12 +46,78 @@ func NewDatabase(config adapter.Config) (adapter.Database, error) {
 	}, nil
 }
 
-func (d *PostgresDatabase) TableNames() ([]string, error) {
-	rows, err := d.db.Query(
+// Return the schema where unqualified names are created, i.e. the first existing schema in search_path.
+// It's "public" if no schema in search_path exists.
+func CurrentSchema(ctx context.Context, db adapter.Database) (string, error) {
+	var schema sql.NullString
+	if err := db.DB().QueryRowContext(ctx, "select current_schema();").Scan(&schema); err != nil {
+		return "", err
+	}
+	if !schema.Valid {
+		return "public", nil
+	}
+	return schema.String, nil
+}
+
+// Return the search_path setting of the session, e.g. "$user", public
+func SearchPath(ctx context.Context, db adapter.Database) (string, error) {
+	var searchPath string
+	err := db.DB().QueryRowContext(ctx, "select current_setting('search_path');").Scan(&searchPath)
+	return searchPath, err
+}
+
+// Connect to the database where unqualified names are created in the default schema, and return it with the schema.
+// The default schema is defaultSchema if given, current_schema() if it's managed, or the first of schemas otherwise.
+// schemas are the values of --schema, which manage all schemas when it's empty.
+func NewDatabaseWithDefaultSchema(config adapter.Config, defaultSchema string, schemas []string) (adapter.Database, string, error) {
+	ctx := context.Background()
+	database, err := NewDatabase(config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	currentSchema, err := CurrentSchema(ctx, database)
+	if err != nil {
+		database.Close()
+		return nil, "", err
+	}
+	if defaultSchema == "" && (len(schemas) == 0 || containsString(schemas, currentSchema)) {
+		defaultSchema = currentSchema
+	}
+	if defaultSchema == "" {
+		defaultSchema = schemas[0]
+	}
+	if defaultSchema == currentSchema {
+		return database, defaultSchema, nil
+	}
+
+	// Let unqualified names in DDLs be created in the default schema
+	searchPath, err := SearchPath(ctx, database)
+	database.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	params := map[string]string{}
+	for key, value := range config.Params {
+		params[key] = value
+	}
+	params["search_path"] = pq.QuoteIdentifier(defaultSchema)
+	if searchPath != "" {
+		params["search_path"] += ", " + searchPath
+	}
+	config.Params = params
+	database, err = NewDatabase(config)
+	return database, defaultSchema, err
+}
+
+func (d *PostgresDatabase) TableNames(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx,
 		`select table_schema, table_name from information_schema.tables
 		 where table_schema not in ('information_schema', 'pg_catalog')
 		 and (table_schema != 'public' or table_name != 'pg_buffercache')
+		 and (cardinality($1::text[]) = 0 or table_schema = any($1))
 		 and table_type = 'BASE TABLE';`,
+		pq.Array(d.config.PostgresSchemas),
 	)
 	if err != nil {
 		return nil, err
@@ -60,13 +140,15 @@ var (
 	spaces          = regexp.MustCompile(`[ ]+`)
 )
 
-func (d *PostgresDatabase) Views() ([]string, error) {
-	rows, err := d.db.Query(
+func (d *PostgresDatabase) Views(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx,
 		`select table_schema, table_name, definition from information_schema.tables
 		 inner join pg_views on table_name = viewname
 		 where table_schema not in ('information_schema', 'pg_catalog')
 		 and (table_schema != 'public' or table_name != 'pg_buffercache')
+		 and (cardinality($1::text[]) = 0 or table_schema = any($1))
 		 and table_type = 'VIEW';`,
+		pq.Array(d.config.PostgresSchemas),
 	)
 	if err != nil {
 		return nil, err
@@ -92,16 +174,19 @@ func (d *PostgresDatabase) Views() ([]string, error) {
 	return ddls, nil
 }
 
-func (d *PostgresDatabase) Triggers() ([]string, error) {
+func (d *PostgresDatabase) Triggers(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
-func (d *PostgresDatabase) Types() ([]string, error) {
-	rows, err := d.db.Query(
-		`select t.typname, string_agg(e.enumlabel, ' ')
+func (d *PostgresDatabase) Types(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`select n.nspname, t.typname, string_agg(e.enumlabel, ' ')
 		 from pg_enum e
 		 join pg_type t on e.enumtypid = t.oid
-		 group by t.typname;`,
+		 join pg_namespace n on t.typnamespace = n.oid
+		 where cardinality($1::text[]) = 0 or n.nspname = any($1)
+		 group by n.nspname, t.typname;`,
+		pq.Array(d.config.PostgresSchemas),
 	)
 	if err != nil {
 		return nil, err
@@ -110,10 +195,13 @@ func (d *PostgresDatabase) Types() ([]string, error) {
 
 	var ddls []string
 	for rows.Next() {
-		var typeName, labels string
-		if err := rows.Scan(&typeName, &labels); err != nil {
+		var schema, typeName, labels string
+		if err := rows.Scan(&schema, &typeName, &labels); err != nil {
 			return nil, err
 		}
+		if schema != "public" {
+			typeName = schema + "." + typeName
+		}
 		enumLabels := []string{}
 		for _, label := range strings.Split(labels, " ") {
 			enumLabels = append(enumLabels, fmt.Sprintf("'%s'", label))
@@ -127,32 +215,32 @@ func (d *PostgresDatabase) Types() ([]string, error) {
 	return ddls, nil
 }
 
-func (d *PostgresDatabase) DumpTableDDL(table string) (string, error) {
-	cols, err := d.getColumns(table)
+func (d *PostgresDatabase) DumpTableDDL(ctx context.Context, table string) (string, error) {
+	cols, err := d.getColumns(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	pkeyCols, err := d.getPrimaryKeyColumns(table)
+	pkeyCols, err := d.getPrimaryKeyColumns(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	indexDefs, err := d.getIndexDefs(table)
+	indexDefs, err := d.getIndexDefs(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	foreignDefs, err := d.getForeignDefs(table)
+	foreignDefs, err := d.getForeignDefs(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	policyDefs, err := d.getPolicyDefs(table)
+	policyDefs, err := d.getPolicyDefs(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	checkConstraints, err := d.getTableCheckConstraints(table)
+	checkConstraints, err := d.getTableCheckConstraints(ctx, table)
 	if err != nil {
 		return "", err
 	}
-	uniqueConstraints, err := d.getUniqueConstraints(table)
+	uniqueConstraints, err := d.getUniqueConstraints(ctx, table)
 	if err != nil {
 		return "", err
 	}
@@ -188,9 +276,9 @@ func buildDumpTableDDL(table string, columns []column, pkeyCols, indexDefs, fore
 		fmt.Fprint(&queryBuilder, ",\n"+indent)
 		fmt.Fprintf(&queryBuilder, "PRIMARY KEY (\"%s\")", strings.Join(pkeyCols, "\", \""))
 	}
-	for constraintName, constraintDef := range checkConstraints {
+	for _, constraintName := range sortedKeys(checkConstraints) {
 		fmt.Fprint(&queryBuilder, ",\n"+indent)
-		fmt.Fprintf(&queryBuilder, "CONSTRAINT %s %s", constraintName, constraintDef)
+		fmt.Fprintf(&queryBuilder, "CONSTRAINT %s %s", constraintName, checkConstraints[constraintName])
 	}
 	fmt.Fprintf(&queryBuilder, "\n);\n")
 	for _, v := range indexDefs {
@@ -202,12 +290,22 @@ func buildDumpTableDDL(table string, columns []column, pkeyCols, indexDefs, fore
 	for _, v := range policyDefs {
 		fmt.Fprintf(&queryBuilder, "%s;\n", v)
 	}
-	for _, constraintDef := range uniqueConstraints {
-		fmt.Fprintf(&queryBuilder, "%s;\n", constraintDef)
+	for _, constraintName := range sortedKeys(uniqueConstraints) {
+		fmt.Fprintf(&queryBuilder, "%s;\n", uniqueConstraints[constraintName])
 	}
 	return strings.TrimSuffix(queryBuilder.String(), "\n")
 }
 
+// Map iteration order is random, but the dump must be stable to fingerprint it.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 type columnConstraint struct {
 	definition string
 	name       string
@@ -254,7 +352,7 @@ func (c *column) GetDataType() string {
 	}
 }
 
-func (d *PostgresDatabase) getColumns(table string) ([]column, error) {
+func (d *PostgresDatabase) getColumns(ctx context.Context, table string) ([]column, error) {
 	const query = `WITH
 	  columns AS (
 	    SELECT
@@ -305,7 +403,7 @@ func (d *PostgresDatabase) getColumns(table string) ([]column, error) {
 	LEFT JOIN check_constraints checks USING (column_name);`
 
 	schema, table := SplitTableName(table)
-	rows, err := d.db.Query(query, schema, table)
+	rows, err := d.db.QueryContext(ctx, query, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -351,8 +449,9 @@ func (d *PostgresDatabase) getColumns(table string) ([]column, error) {
 	return cols, nil
 }
 
-func (d *PostgresDatabase) getIndexDefs(table string) ([]string, error) {
+func (d *PostgresDatabase) getIndexDefs(ctx context.Context, table string) ([]string, error) {
 	// Exclude indexes that are implicitly created for primary keys or unique constraints.
+	// INVALID indexes left by failed CREATE INDEX CONCURRENTLY are excluded too, like pg_dump.
 	const query = `WITH
 	  unique_and_pk_constraints AS (
 	    SELECT con.conname AS name
@@ -362,15 +461,24 @@ func (d *PostgresDatabase) getIndexDefs(table string) ([]string, error) {
 	    WHERE  con.contype IN ('p', 'u')
 	    AND    nsp.nspname = $1
 	    AND    cls.relname = $2
+	  ),
+	  invalid_indexes AS (
+	    SELECT cls.relname AS name
+	    FROM   pg_index idx
+	    JOIN   pg_class cls ON cls.oid = idx.indexrelid
+	    JOIN   pg_namespace nsp ON nsp.oid = cls.relnamespace
+	    WHERE  NOT idx.indisvalid
+	    AND    nsp.nspname = $1
 	  )
 	SELECT indexName, indexdef
 	FROM   pg_indexes
 	WHERE  schemaname = $1
 	AND    tablename = $2
 	AND    indexName NOT IN (SELECT name FROM unique_and_pk_constraints)
+	AND    indexName NOT IN (SELECT name FROM invalid_indexes)
 	`
 	schema, table := SplitTableName(table)
-	rows, err := d.db.Query(query, schema, table)
+	rows, err := d.db.QueryContext(ctx, query, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -390,7 +498,39 @@ func (d *PostgresDatabase) getIndexDefs(table string) ([]string, error) {
 	return indexes, nil
 }
 
-func (d *PostgresDatabase) getTableCheckConstraints(tableName string) (map[string]string, error) {
+// Return DROP INDEX CONCURRENTLY of INVALID indexes, which are left by failed CREATE INDEX CONCURRENTLY
+func (d *PostgresDatabase) InvalidIndexDrops(ctx context.Context) ([]adapter.InvalidIndexDrop, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`select nsp.nspname, tbl.relname, cls.relname from pg_index idx
+		 join pg_class cls on cls.oid = idx.indexrelid
+		 join pg_class tbl on tbl.oid = idx.indrelid
+		 join pg_namespace nsp on nsp.oid = cls.relnamespace
+		 where not idx.indisvalid
+		 and (cardinality($1::text[]) = 0 or nsp.nspname = any($1))
+		 order by nsp.nspname, cls.relname;`,
+		pq.Array(d.config.PostgresSchemas),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drops []adapter.InvalidIndexDrop
+	for rows.Next() {
+		var schema, table, name string
+		if err := rows.Scan(&schema, &table, &name); err != nil {
+			return nil, err
+		}
+		drops = append(drops, adapter.InvalidIndexDrop{
+			Table: schema + "." + table,
+			Index: name,
+			SQL:   fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s.%s", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(name)),
+		})
+	}
+	return drops, rows.Err()
+}
+
+func (d *PostgresDatabase) getTableCheckConstraints(ctx context.Context, tableName string) (map[string]string, error) {
 	const query = `SELECT con.conname, pg_get_constraintdef(con.oid, true)
 	FROM   pg_constraint con
 	JOIN   pg_namespace nsp ON nsp.oid = con.connamespace
@@ -402,7 +542,7 @@ func (d *PostgresDatabase) getTableCheckConstraints(tableName string) (map[strin
 
 	result := map[string]string{}
 	schema, table := SplitTableName(tableName)
-	rows, err := d.db.Query(query, schema, table)
+	rows, err := d.db.QueryContext(ctx, query, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -420,7 +560,7 @@ func (d *PostgresDatabase) getTableCheckConstraints(tableName string) (map[strin
 	return result, nil
 }
 
-func (d *PostgresDatabase) getUniqueConstraints(tableName string) (map[string]string, error) {
+func (d *PostgresDatabase) getUniqueConstraints(ctx context.Context, tableName string) (map[string]string, error) {
 	const query = `SELECT con.conname, pg_get_constraintdef(con.oid)
 	FROM   pg_constraint con
 	JOIN   pg_namespace nsp ON nsp.oid = con.connamespace
@@ -431,7 +571,7 @@ func (d *PostgresDatabase) getUniqueConstraints(tableName string) (map[string]st
 
 	result := map[string]string{}
 	schema, table := SplitTableName(tableName)
-	rows, err := d.db.Query(query, schema, table)
+	rows, err := d.db.QueryContext(ctx, query, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -449,7 +589,7 @@ func (d *PostgresDatabase) getUniqueConstraints(tableName string) (map[string]st
 	return result, nil
 }
 
-func (d *PostgresDatabase) getPrimaryKeyColumns(table string) ([]string, error) {
+func (d *PostgresDatabase) getPrimaryKeyColumns(ctx context.Context, table string) ([]string, error) {
 	const query = `SELECT
 	tc.table_schema, tc.constraint_name, tc.table_name, kcu.column_name
 FROM
@@ -458,7 +598,7 @@ FROM
 		USING (table_schema, table_name, constraint_name)
 WHERE constraint_type = 'PRIMARY KEY' AND tc.table_schema=$1 AND tc.table_name=$2 ORDER BY kcu.ordinal_position`
 	schema, table := SplitTableName(table)
-	rows, err := d.db.Query(query, schema, table)
+	rows, err := d.db.QueryContext(ctx, query, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -478,7 +618,7 @@ WHERE constraint_type = 'PRIMARY KEY' AND tc.table_schema=$1 AND tc.table_name=$
 }
 
 // refs: https://gist.github.com/PickledDragon/dd41f4e72b428175354d
-func (d *PostgresDatabase) getForeignDefs(table string) ([]string, error) {
+func (d *PostgresDatabase) getForeignDefs(ctx context.Context, table string) ([]string, error) {
 	const query = `SELECT
 	tc.table_schema, tc.constraint_name, tc.table_name, kcu.column_name,
 	ccu.table_schema AS foreign_table_schema,
@@ -496,7 +636,7 @@ FROM
 		ON tc.constraint_name = rc.constraint_name
 WHERE constraint_type = 'FOREIGN KEY' AND tc.table_schema=$1 AND tc.table_name=$2`
 	schema, table := SplitTableName(table)
-	rows, err := d.db.Query(query, schema, table)
+	rows, err := d.db.QueryContext(ctx, query, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -523,10 +663,10 @@ var (
 	policyRolesSuffixRegex = regexp.MustCompile(`}$`)
 )
 
-func (d *PostgresDatabase) getPolicyDefs(table string) ([]string, error) {
+func (d *PostgresDatabase) getPolicyDefs(ctx context.Context, table string) ([]string, error) {
 	const query = "SELECT policyname, permissive, roles, cmd, qual, with_check FROM pg_policies WHERE schemaname = $1 AND tablename = $2;"
 	schema, table := SplitTableName(table)
-	rows, err := d.db.Query(query, schema, table)
+	rows, err := d.db.QueryContext(ctx, query, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -559,6 +699,29 @@ func (d *PostgresDatabase) getPolicyDefs(table string) ([]string, error) {
 	return defs, nil
 }
 
+// lock_timeout and statement_timeout in milliseconds
+func (d *PostgresDatabase) TimeoutStatements(lockTimeout time.Duration, statementTimeout time.Duration) ([]string, error) {
+	var statements []string
+	if lockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("SET lock_timeout = %d", (lockTimeout+time.Millisecond-1)/time.Millisecond))
+	}
+	if statementTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("SET statement_timeout = %d", (statementTimeout+time.Millisecond-1)/time.Millisecond))
+	}
+	return statements, nil
+}
+
+// True for lock_not_available, which is raised by lock_timeout
+func (d *PostgresDatabase) IsLockTimeout(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "55P03"
+}
+
+// A failed statement aborts the transaction unless it's rolled back to a savepoint
+func (d *PostgresDatabase) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+
 func (d *PostgresDatabase) DB() *sql.DB {
 	return d.db
 }
@@ -578,17 +741,27 @@ func postgresBuildDSN(config adapter.Config) string {
 		host = config.Socket
 	}
 
-	var options []string
-	if sslmode, ok := os.LookupEnv("PGSSLMODE"); ok { // TODO: have this in adapter.Config, or standardize config with DSN?
-		options = append(options, fmt.Sprintf("sslmode=%s", sslmode)) // TODO: uri escape
+	// The driver reads $PGSSLMODE, $PGSSLROOTCERT, $PGSSLCERT and $PGSSLKEY for empty ones.
+	options := url.Values{}
+	if config.SSLMode != "" {
+		options.Set("sslmode", adapter.NormalizeSSLMode(config.SSLMode))
+	}
+	if config.SSLCA != "" {
+		options.Set("sslrootcert", config.SSLCA)
+	}
+	if config.SSLCert != "" {
+		options.Set("sslcert", config.SSLCert)
+	}
+	if config.SSLKey != "" {
+		options.Set("sslkey", config.SSLKey)
 	}
 
-	if sslrootcert, ok := os.LookupEnv("PGSSLROOTCERT"); ok { // TODO: have this in adapter.Config, or standardize config with DSN?
-		options = append(options, fmt.Sprintf("sslrootcert=%s", sslrootcert))
+	for key, value := range config.Params {
+		options.Set(key, value)
 	}
 
 	// `QueryEscape` instead of `PathEscape` so that colon can be escaped.
-	return fmt.Sprintf("postgres://%s:%s@%s/%s?%s", url.QueryEscape(user), url.QueryEscape(password), host, database, strings.Join(options, "&"))
+	return fmt.Sprintf("postgres://%s:%s@%s/%s?%s", url.QueryEscape(user), url.QueryEscape(password), host, database, options.Encode())
 }
 
 func SplitTableName(table string) (string, string) {
@@ -600,3 +773,12 @@ func SplitTableName(table string) (string, string) {
 	}
 	return schema, table
 }
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
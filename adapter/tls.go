@@ -0,0 +1,20 @@
+package adapter
+
+import "strings"
+
+// Normalize MySQL's --ssl-mode values, e.g. VERIFY_IDENTITY, to libpq's sslmode values, e.g. verify-full.
+func NormalizeSSLMode(mode string) string {
+	mode = strings.ReplaceAll(strings.ToLower(mode), "_", "-")
+	switch mode {
+	case "disabled":
+		return "disable"
+	case "preferred":
+		return "prefer"
+	case "required":
+		return "require"
+	case "verify-identity":
+		return "verify-full"
+	default:
+		return mode
+	}
+}
@@ -1348,6 +1348,100 @@ func TestMysqldefSkipDrop(t *testing.T) {
 	assertEquals(t, skipDrop, strings.Replace(apply, "DROP", "-- Skipped: DROP", 1))
 }
 
+func TestMysqldefAlgorithm(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("mysql", "-uroot", "mysqldef_test", "-e", stripHeredoc(`
+		CREATE TABLE users (
+		  id bigint NOT NULL,
+		  name varchar(40)
+		);`,
+	))
+
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (
+		  id bigint NOT NULL,
+		  name text
+		);`,
+	))
+
+	// Changing a column type is rejected by INPLACE, and then COPY is used
+	out := assertedExecute(t, "./mysqldef", "-uroot", "mysqldef_test", "--algorithm=inplace,copy", "--file", "schema.sql")
+	if !strings.Contains(out, "ALTER TABLE `users` CHANGE COLUMN `name` `name` text, ALGORITHM=INPLACE;\n-- Rejected: ") ||
+		!strings.HasSuffix(out, "ALTER TABLE `users` CHANGE COLUMN `name` `name` text, ALGORITHM=COPY;\n") {
+		t.Errorf("expected a fallback from INPLACE to COPY, but got: %s", out)
+	}
+	out = assertedExecute(t, "./mysqldef", "-uroot", "mysqldef_test", "--algorithm=inplace,copy", "--file", "schema.sql")
+	assertEquals(t, out, nothingModified)
+
+	out, err := execute("./mysqldef", "-uroot", "mysqldef_test", "--algorithm=fast", "--file", "schema.sql")
+	if err == nil {
+		t.Errorf("expected an error of an unknown algorithm, but got: %s", out)
+	}
+}
+
+func TestMysqldefOnlineSchemaChange(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("mysql", "-uroot", "mysqldef_test", "-e", stripHeredoc(`
+		CREATE TABLE users (
+		  id bigint NOT NULL,
+		  age int
+		);`,
+	))
+
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (
+		  id bigint NOT NULL,
+		  name varchar(40)
+		);`,
+	))
+
+	// ALTER TABLE of each table larger than 0 bytes is grouped to a command
+	out := assertedExecute(t, "./mysqldef", "-uroot", "mysqldef_test", "--online-schema-change=gh-ost", "--online-schema-change-size=0",
+		"--online-schema-change-args=--allow-on-master", "--dry-run", "--file", "schema.sql")
+	command := "-- Skipped: gh-ost --host=127.0.0.1 --port=3306 --user=root --database=mysqldef_test --table=users " +
+		"'--alter=ADD COLUMN `name` varchar(40) AFTER `id`, DROP COLUMN `age`' --allow-on-master --execute\n"
+	if !strings.HasPrefix(out, "-- dry run --\n-- Online schema change of 'users' (") || !strings.HasSuffix(out, command) {
+		t.Errorf("expected a command of gh-ost, but got: %s", out)
+	}
+
+	// The password is given by a temporary option file, not by the arguments
+	out = assertedExecute(t, "./mysqldef", "-uroot", "mysqldef_test", "--online-schema-change=pt-online-schema-change", "--online-schema-change-size=0",
+		"--online-schema-change-execute", "--dry-run", "--file", "schema.sql")
+	if !regexp.MustCompile(` --execute h=127\.0\.0\.1,P=3306,u=root,F=\S+\.cnf,D=mysqldef_test,t=users\n$`).MatchString(out) {
+		t.Errorf("expected a command of pt-online-schema-change with an option file, but got: %s", out)
+	}
+
+	// Small tables are altered as usual
+	out = assertedExecute(t, "./mysqldef", "-uroot", "mysqldef_test", "--online-schema-change=pt-online-schema-change", "--dry-run", "--file", "schema.sql")
+	assertEquals(t, out, "-- dry run --\n"+
+		"ALTER TABLE `users` ADD COLUMN `name` varchar(40) AFTER `id`;\n"+
+		"ALTER TABLE `users` DROP COLUMN `age`;\n",
+	)
+}
+
+func TestMysqldefDefaultsFile(t *testing.T) {
+	resetTestDatabase()
+	defer os.Remove("my.cnf")
+	writeFile("my.cnf", stripHeredoc(`
+		[mysql]
+		database = unused
+
+		[client]
+		user = root
+		database = mysqldef_test
+		`,
+	))
+
+	out := assertedExecute(t, "./mysqldef", "--defaults-file", "my.cnf", "--export")
+	assertEquals(t, out, "-- No table exists --\n")
+
+	// Options in the command line take precedence
+	out, err := execute("./mysqldef", "--defaults-file", "my.cnf", "--export", "mysqldef_unknown")
+	if err == nil {
+		t.Errorf("expected an error of an unknown database, but got: %s", out)
+	}
+}
+
 func TestMysqldefHelp(t *testing.T) {
 	_, err := execute("./mysqldef", "--help")
 	if err != nil {
@@ -17,6 +17,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -1277,6 +1278,72 @@ func TestPsqldefSkipDrop(t *testing.T) {
 	assertEquals(t, skipDrop, strings.Replace(apply, "DROP", "-- Skipped: DROP", 1))
 }
 
+func TestPsqldefSkipDropDestructiveChanges(t *testing.T) {
+	resetTestDatabase()
+	mustExecuteSQL(stripHeredoc(`
+		CREATE TABLE users (
+		    id bigint NOT NULL PRIMARY KEY,
+		    name varchar(20) NOT NULL DEFAULT 'none',
+		    age bigint
+		);
+		CREATE INDEX index_users_on_age ON users (age);`,
+	))
+
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (
+		    id bigint NOT NULL PRIMARY KEY,
+		    name varchar(10),
+		    age bigint,
+		    DROPPED_AT timestamp
+		);
+		CREATE INDEX index_users_on_age ON users (age, name);`,
+	))
+
+	// Only the narrowing type change is destructive
+	skipDrop := assertedExecute(t, "./psqldef", "-Upostgres", database, "--skip-drop", "--file", "schema.sql")
+	assertEquals(t, skipDrop, stripHeredoc(`
+		-- Apply --
+		-- Skipped: ALTER TABLE "public"."users" ALTER COLUMN "name" TYPE varchar(10);
+		ALTER TABLE "public"."users" ALTER COLUMN "name" DROP NOT NULL;
+		ALTER TABLE "public"."users" ALTER COLUMN "name" DROP DEFAULT;
+		ALTER TABLE "public"."users" ADD COLUMN "DROPPED_AT" timestamp;
+		DROP INDEX "public"."index_users_on_age";
+		CREATE INDEX index_users_on_age ON users (age, name);
+		`,
+	))
+}
+
+func TestPsqldefDetectRenames(t *testing.T) {
+	resetTestDatabase()
+	mustExecuteSQL(stripHeredoc(`
+		CREATE TABLE users (
+		    id bigint NOT NULL PRIMARY KEY,
+		    name text,
+		    age integer
+		);
+		CREATE INDEX users_age_idx ON users (age);`,
+	))
+
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (
+		    id bigint NOT NULL PRIMARY KEY,
+		    username text,
+		    age integer
+		);
+		CREATE INDEX index_users_on_age ON users (age);`,
+	))
+
+	dryRun := assertedExecute(t, "./psqldef", "-Upostgres", database, "--dry-run", "--detect-renames", "--file", "schema.sql")
+	assertEquals(t, dryRun, stripHeredoc(`
+		-- dry run --
+		-- Detected rename of column 'name' to 'username'. Make sure it's not dropped and added.
+		ALTER TABLE "public"."users" RENAME COLUMN "name" TO "username";
+		-- Detected rename of index 'users_age_idx' to 'index_users_on_age'. Make sure it's not dropped and added.
+		ALTER INDEX "public"."users_age_idx" RENAME TO "index_users_on_age";
+		`,
+	))
+}
+
 func TestPsqldefExport(t *testing.T) {
 	resetTestDatabase()
 
@@ -1356,6 +1423,141 @@ func TestPsqldefBeforeApply(t *testing.T) {
 	assertEquals(t, owner, "dummy_owner_role\n")
 }
 
+func TestPsqldefConcurrently(t *testing.T) {
+	resetTestDatabase()
+	mustExecuteSQL("CREATE TABLE users (id bigint NOT NULL, name text);")
+	mustExecuteSQL("INSERT INTO users VALUES (1, 'alice'), (2, 'alice');")
+
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (id bigint NOT NULL, name text);
+		CREATE UNIQUE INDEX index_name ON users (name);
+		`,
+	))
+
+	// The unique index can't be built, and its INVALID index is dropped
+	out, err := execute("./psqldef", "-Upostgres", database, "-f", "schema.sql", "--concurrently")
+	if err == nil {
+		t.Errorf("expected an error of duplicated names, but got: %s", out)
+	}
+	dropped := "-- Dropped the INVALID index left by the failure: DROP INDEX CONCURRENTLY IF EXISTS \"public\".\"index_name\"; --\n"
+	if !strings.HasPrefix(out, applyPrefix+"CREATE UNIQUE INDEX CONCURRENTLY index_name ON users (name);\n") || !strings.Contains(out, dropped) {
+		t.Errorf("expected the INVALID index to be dropped, but got: %s", out)
+	}
+
+	mustExecuteSQL("DELETE FROM users WHERE id = 2;")
+	out = assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--concurrently")
+	assertEquals(t, out, applyPrefix+"CREATE UNIQUE INDEX CONCURRENTLY index_name ON users (name);\n")
+	out = assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--concurrently")
+	assertEquals(t, out, nothingModified)
+}
+
+func TestPsqldefConcurrentlyKeepsOtherInvalidIndexes(t *testing.T) {
+	resetTestDatabase()
+	mustExecuteSQL("CREATE TABLE users (id bigint NOT NULL, name text);")
+	mustExecuteSQL("INSERT INTO users VALUES (1, 'alice'), (2, 'alice');")
+	// Left by another session, which is not in the schema
+	if out, err := executeSQL("CREATE UNIQUE INDEX CONCURRENTLY index_other ON users (name);"); err == nil {
+		t.Fatalf("expected an error of duplicated names, but got: %s", out)
+	}
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (id bigint NOT NULL, name text);
+		CREATE INDEX index_id ON users (id);
+		`,
+	))
+
+	out := assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--concurrently")
+	assertEquals(t, out, applyPrefix+"CREATE INDEX CONCURRENTLY index_id ON users (id);\n")
+	invalid := assertedExecute(t, "psql", "-Upostgres", database, "-tAc", "SELECT count(*) FROM pg_index WHERE NOT indisvalid")
+	assertEquals(t, invalid, "1\n")
+}
+
+func TestPsqldefLockTimeout(t *testing.T) {
+	resetTestDatabase()
+	mustExecuteSQL("CREATE TABLE users (id bigint NOT NULL);")
+	writeFile("schema.sql", "CREATE TABLE users (id bigint NOT NULL, name text);")
+
+	out, err := execute("./psqldef", "-Upostgres", database, "-f", "schema.sql", "--lock-retries=1")
+	if err == nil || !strings.Contains(out, "--lock-retries requires --lock-timeout") {
+		t.Errorf("expected an error of --lock-retries without --lock-timeout, but got: %s", out)
+	}
+
+	// Another session holds the lock of the table longer than the retries
+	locker := exec.Command("psql", "-Upostgres", database, "-c", "BEGIN; LOCK TABLE users; SELECT pg_sleep(3); COMMIT;")
+	if err := locker.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	out, err = execute("./psqldef", "-Upostgres", database, "-f", "schema.sql", "--lock-timeout=100ms", "--lock-retries=1")
+	if err == nil {
+		t.Errorf("expected an error of the lock timeout, but got: %s", out)
+	}
+	retrying := "-- Lock timeout: pq: canceling statement due to lock timeout. Retrying in 1s (1/1) --\n"
+	if !strings.HasPrefix(out, applyPrefix+`ALTER TABLE "public"."users" ADD COLUMN "name" text;`+"\n"+retrying) {
+		t.Errorf("expected the DDL to be retried once, but got: %s", out)
+	}
+
+	if err := locker.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	out = assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--lock-timeout=100ms", "--statement-timeout=10s")
+	assertEquals(t, out, applyPrefix+`ALTER TABLE "public"."users" ADD COLUMN "name" text;`+"\n")
+}
+
+func TestPsqldefService(t *testing.T) {
+	resetTestDatabase()
+	defer os.Remove("pg_service.conf")
+	writeFile("pg_service.conf", stripHeredoc(`
+		[test]
+		user=postgres
+		dbname=psqldef_test
+		application_name=psqldef
+		`,
+	))
+	os.Setenv("PGSERVICEFILE", "pg_service.conf")
+	os.Setenv("PGSERVICE", "test")
+	defer os.Unsetenv("PGSERVICEFILE")
+	defer os.Unsetenv("PGSERVICE")
+
+	out := assertedExecute(t, "./psqldef", "--export")
+	assertEquals(t, out, "-- No table exists --\n")
+
+	os.Setenv("PGSERVICE", "unknown")
+	out, err := execute("./psqldef", "--export")
+	if err == nil || !strings.Contains(out, "service 'unknown' is not found in: pg_service.conf") {
+		t.Errorf("expected an error of an unknown service, but got: %s", out)
+	}
+}
+
+func TestPsqldefSchema(t *testing.T) {
+	resetTestDatabase()
+	mustExecuteSQL("CREATE SCHEMA app;")
+	mustExecuteSQL("CREATE TABLE public.legacy (id integer);")
+
+	// Unqualified names belong to --default-schema, and public.legacy is out of --schema
+	createTable := "CREATE TABLE users (id integer);"
+	writeFile("schema.sql", createTable)
+	apply := assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--schema", "app", "--default-schema", "app")
+	assertEquals(t, apply, applyPrefix+createTable+"\n")
+	apply = assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--schema", "app", "--default-schema", "app")
+	assertEquals(t, apply, nothingModified)
+
+	// The first --schema is the default schema unless it's in search_path
+	apply = assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--schema", "app")
+	assertEquals(t, apply, nothingModified)
+
+	tables := assertedExecute(t, "psql", "-Upostgres", database, "-tAc", "SELECT schemaname || '.' || tablename FROM pg_tables WHERE schemaname IN ('public', 'app') ORDER BY 1")
+	assertEquals(t, tables, "app.users\npublic.legacy\n")
+
+	out := assertedExecute(t, "./psqldef", "-Upostgres", database, "--export", "--schema", "app")
+	assertEquals(t, out, "CREATE TABLE app.users (\n    \"id\" integer\n);\n")
+
+	// Tables of the desired schema out of --schema are ignored too
+	writeFile("schema.sql", createTable+"\nCREATE TABLE public.logs (id integer);")
+	apply = assertedExecute(t, "./psqldef", "-Upostgres", database, "-f", "schema.sql", "--schema", "app", "--default-schema", "app")
+	assertEquals(t, apply, nothingModified)
+}
+
 func TestPsqldefHelp(t *testing.T) {
 	_, err := execute("./psqldef", "--help")
 	if err != nil {
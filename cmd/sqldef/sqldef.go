@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/k0kubun/sqldef"
+	"github.com/k0kubun/sqldef/adapter"
+	"github.com/k0kubun/sqldef/adapter/file"
+	"github.com/k0kubun/sqldef/adapter/mssql"
+	"github.com/k0kubun/sqldef/adapter/mysql"
+	"github.com/k0kubun/sqldef/adapter/postgres"
+	"github.com/k0kubun/sqldef/adapter/sqlite3"
+	"github.com/k0kubun/sqldef/schema"
+)
+
+var version string
+
+// Connect to the database of each dialect
+var newDatabases = map[schema.GeneratorMode]func(config adapter.Config) (adapter.Database, error){
+	schema.GeneratorModeMysql:    mysql.NewDatabase,
+	schema.GeneratorModePostgres: postgres.NewDatabase,
+	schema.GeneratorModeSQLite3:  sqlite3.NewDatabase,
+	schema.GeneratorModeMssql:    mssql.NewDatabase,
+}
+
+func main() {
+	mode, config, desiredConfig, options := sqldef.ParseOptions("", version, os.Args[1:])
+
+	if options.ConvertTo != "" {
+		sqldef.Convert(mode, options)
+		return
+	}
+
+	var database adapter.Database
+	if len(options.CurrentFile) > 0 {
+		database = file.NewDatabase(options.CurrentFile)
+	} else {
+		var err error
+		if mode == schema.GeneratorModePostgres {
+			database, options.DefaultSchema, err = postgres.NewDatabaseWithDefaultSchema(config, options.DefaultSchema, options.Schemas)
+		} else {
+			database, err = newDatabases[mode](config)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer database.Close()
+	}
+
+	if desiredConfig != nil {
+		desiredDatabase, err := newDatabases[mode](*desiredConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer desiredDatabase.Close()
+		options.DesiredDB = desiredDatabase
+	}
+	if options.DefaultSchema == "" && len(options.Schemas) > 0 {
+		options.DefaultSchema = options.Schemas[0]
+	}
+
+	sqldef.Run(mode, database, options)
+}
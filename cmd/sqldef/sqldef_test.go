@@ -0,0 +1,245 @@
+// Integration test of sqldef command. Other dialects share the code tested by mysqldef, psqldef and mssqldef.
+//
+// Test requirement:
+//   - go command
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const (
+	applyPrefix     = "-- Apply --\n"
+	nothingModified = "-- Nothing is modified --\n"
+)
+
+func TestSqldefDialect(t *testing.T) {
+	resetTestDatabase()
+	createTable := "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);"
+	writeFile("schema.sql", createTable)
+
+	out := assertedExecute(t, "./sqldef", "sqlite3", "sqldef_test", "-f", "schema.sql")
+	assertEquals(t, out, applyPrefix+createTable+"\n")
+
+	// Inferred from the scheme of the connection URL
+	out = assertedExecute(t, "./sqldef", "file:sqldef_test", "-f", "schema.sql")
+	assertEquals(t, out, nothingModified)
+	out = assertedExecute(t, "./sqldef", "--dsn", "file:sqldef_test", "-f", "schema.sql")
+	assertEquals(t, out, nothingModified)
+
+	out, err := execute("./sqldef", "sqldef_test", "-f", "schema.sql")
+	if err == nil || !strings.Contains(out, "No dialect is specified! Give one of mysql, postgres, sqlite3, mssql as the first argument") {
+		t.Errorf("expected an error of no dialect, but got: %s", out)
+	}
+}
+
+func TestSqldefDialectOptions(t *testing.T) {
+	resetTestDatabase()
+	writeFile("schema.sql", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);")
+
+	// Available for all dialects
+	out := assertedExecute(t, "./sqldef", "sqlite3", "sqldef_test", "-f", "schema.sql", "--before-apply", "CREATE TABLE logs (id integer);", "--exclude", "logs")
+	assertEquals(t, out, applyPrefix+"CREATE TABLE logs (id integer);\nCREATE TABLE users (id integer NOT NULL PRIMARY KEY);\n")
+
+	out, err := execute("./sqldef", "sqlite3", "sqldef_test", "-f", "schema.sql", "--schema", "public")
+	if err == nil || !strings.Contains(out, "--schema is not supported by sqlite3") {
+		t.Errorf("expected an error of --schema, but got: %s", out)
+	}
+
+	out, err = execute("./sqldef", "sqlite3", "sqldef_test", "-f", "schema.sql", "--lock-timeout", "3s")
+	if err == nil || !strings.Contains(out, "--lock-timeout is not supported by sqlite3") {
+		t.Errorf("expected an error of --lock-timeout, but got: %s", out)
+	}
+}
+
+func TestSqldefConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		schema   string
+		expected string
+	}{
+		{
+			name: "mysql to postgres",
+			from: "mysql",
+			to:   "postgres",
+			schema: "CREATE TABLE `users` (\n" +
+				"  `id` bigint unsigned NOT NULL AUTO_INCREMENT,\n" +
+				"  `active` tinyint(1) NOT NULL DEFAULT 1,\n" +
+				"  `created_at` datetime NOT NULL DEFAULT now(),\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				");",
+			expected: "CREATE TABLE \"public\".\"users\" (\n" +
+				"    \"id\" bigint GENERATED BY DEFAULT AS IDENTITY,\n" +
+				"    \"active\" boolean NOT NULL DEFAULT true,\n" +
+				"    \"created_at\" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+				"    PRIMARY KEY (\"id\")\n" +
+				");\n" +
+				"-- Not converted: UNSIGNED of column 'users.id' is dropped\n",
+		},
+		{
+			name: "postgres to mysql",
+			from: "postgres",
+			to:   "mysql",
+			schema: "CREATE TABLE users (\n" +
+				"  id bigserial PRIMARY KEY,\n" +
+				"  name text,\n" +
+				"  active boolean DEFAULT true,\n" +
+				"  created_at timestamptz DEFAULT now()\n" +
+				");\n" +
+				"CREATE INDEX idx_name ON users (lower(name));",
+			expected: "CREATE TABLE `users` (\n" +
+				"    `id` bigint NOT NULL AUTO_INCREMENT,\n" +
+				"    `name` text,\n" +
+				"    `active` tinyint(1) DEFAULT 1,\n" +
+				"    `created_at` datetime DEFAULT CURRENT_TIMESTAMP,\n" +
+				"    PRIMARY KEY (`id`)\n" +
+				");\n" +
+				"-- Not converted: time zone of column 'users.created_at' is dropped\n" +
+				"-- Not converted: expression index 'idx_name' of table 'users' is not converted\n",
+		},
+		{
+			name: "mssql to postgres",
+			from: "mssql",
+			to:   "postgres",
+			schema: "CREATE TABLE users (\n" +
+				"  id int IDENTITY(1,1) PRIMARY KEY,\n" +
+				"  name nvarchar(100) NOT NULL,\n" +
+				"  active bit DEFAULT 1,\n" +
+				"  created_at datetime2 DEFAULT getdate()\n" +
+				");",
+			expected: "CREATE TABLE \"public\".\"users\" (\n" +
+				"    \"id\" integer GENERATED BY DEFAULT AS IDENTITY,\n" +
+				"    \"name\" varchar(100) NOT NULL,\n" +
+				"    \"active\" boolean DEFAULT true,\n" +
+				"    \"created_at\" timestamp DEFAULT CURRENT_TIMESTAMP,\n" +
+				"    PRIMARY KEY (\"id\")\n" +
+				");\n",
+		},
+		{
+			name: "postgres to mssql",
+			from: "postgres",
+			to:   "mssql",
+			schema: "CREATE TABLE users (\n" +
+				"  id serial PRIMARY KEY,\n" +
+				"  bio text,\n" +
+				"  active boolean DEFAULT false,\n" +
+				"  born_on date DEFAULT current_date\n" +
+				");",
+			expected: "CREATE TABLE [dbo].[users] (\n" +
+				"    [id] int IDENTITY(1,1),\n" +
+				"    [bio] varchar(max),\n" +
+				"    [active] bit DEFAULT 0,\n" +
+				"    [born_on] date,\n" +
+				"    PRIMARY KEY ([id])\n" +
+				");\n" +
+				"-- Not converted: default of column 'users.born_on' is dropped\n",
+		},
+		{
+			name: "mysql to sqlite3",
+			from: "mysql",
+			to:   "sqlite3",
+			schema: "CREATE TABLE `users` (\n" +
+				"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+				"  `name` varchar(40) CHARACTER SET utf8mb4,\n" +
+				"  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				");",
+			expected: "CREATE TABLE `users` (\n" +
+				"    `id` integer NOT NULL PRIMARY KEY AUTOINCREMENT,\n" +
+				"    `name` varchar(40),\n" +
+				"    `updated_at` datetime DEFAULT CURRENT_TIMESTAMP\n" +
+				");\n" +
+				"-- Not converted: character set and collation of column 'users.name' are dropped\n" +
+				"-- Not converted: ON UPDATE of column 'users.updated_at' is dropped\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeFile("schema.sql", test.schema)
+			out := assertedExecute(t, "./sqldef", test.from, "--convert-to", test.to, "-f", "schema.sql")
+			assertEquals(t, out, test.expected)
+		})
+	}
+}
+
+func TestSqldefHelp(t *testing.T) {
+	_, err := execute("./sqldef", "--help")
+	if err != nil {
+		t.Errorf("failed to execute 'sqldef --help'")
+	}
+
+	out, err := execute("./sqldef")
+	if err == nil {
+		t.Errorf("no dialect should fail")
+	}
+	if !strings.Contains(out, "Usage:") {
+		t.Errorf("expected the usage, but got: %s", out)
+	}
+}
+
+func TestMain(m *testing.M) {
+	resetTestDatabase()
+	mustExecute("go", "build")
+	status := m.Run()
+	_ = os.Remove("sqldef")
+	_ = os.Remove("sqldef_test")
+	_ = os.Remove("schema.sql")
+	os.Exit(status)
+}
+
+func mustExecute(command string, args ...string) {
+	out, err := execute(command, args...)
+	if err != nil {
+		log.Printf("failed to execute '%s %s': `%s`", command, strings.Join(args, " "), out)
+		log.Fatal(err)
+	}
+}
+
+func assertedExecute(t *testing.T, command string, args ...string) string {
+	t.Helper()
+	out, err := execute(command, args...)
+	if err != nil {
+		t.Errorf("failed to execute '%s %s' (error: '%s'): `%s`", command, strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+func assertEquals(t *testing.T, actual string, expected string) {
+	t.Helper()
+	if expected != actual {
+		t.Errorf("expected '%s' but got '%s'", expected, actual)
+	}
+}
+
+func execute(command string, args ...string) (string, error) {
+	cmd := exec.Command(command, args...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func resetTestDatabase() {
+	_, err := os.Stat("sqldef_test")
+	if err == nil {
+		err := os.Remove("sqldef_test")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func writeFile(path string, content string) {
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	file.Write(([]byte)(content))
+}
@@ -6,13 +6,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/k0kubun/sqldef"
 	"github.com/k0kubun/sqldef/adapter"
 	"github.com/k0kubun/sqldef/adapter/sqlite3"
 	"github.com/k0kubun/sqldef/cmd/testutils"
 	"github.com/k0kubun/sqldef/schema"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -74,6 +80,193 @@ func TestSQLite3defDryRun(t *testing.T) {
 	assertEquals(t, dryRun, strings.Replace(apply, "Apply", "dry run", 1))
 }
 
+func TestSQLite3defCheck(t *testing.T) {
+	resetTestDatabase()
+	createTable := "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);"
+	writeFile("schema.sql", createTable)
+
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--check", "--file", "schema.sql")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Errorf("expected exit status 2, but got: %v", err)
+	}
+	assertEquals(t, out, "-- dry run --\n"+createTable+"\n")
+
+	assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--file", "schema.sql")
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--check", "--file", "schema.sql")
+	assertEquals(t, out, nothingModified)
+
+	// Skipped DDLs are not pending
+	writeFile("schema.sql", "")
+	assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--check", "--skip-drop", "--file", "schema.sql")
+
+	_, err = execute("./sqlite3def", "sqlite3def_test", "--check", "--file", "unknown.sql")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Errorf("expected exit status 1, but got: %v", err)
+	}
+}
+
+func TestSQLite3defInteractive(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("sqlite3", "sqlite3def_test", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY); CREATE TABLE logs (id integer);")
+	writeFile("schema.sql", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY, name text); CREATE TABLE posts (id integer);")
+
+	interactive := func(answers string) (string, error) {
+		cmd := exec.Command("./sqlite3def", "sqlite3def_test", "--interactive", "--transaction=none", "--file", "schema.sql")
+		cmd.Stdin = strings.NewReader(answers)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// A single transaction would hold locks while waiting for answers
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--interactive", "--file", "schema.sql")
+	if err == nil {
+		t.Errorf("expected an error of --interactive without --transaction=none, but got: %s", out)
+	}
+	assertEquals(t, out, "--interactive requires --transaction=none, not to hold locks of a transaction while waiting for answers\n")
+
+	// "quit" stops before running the statement
+	out, err = interactive("quit\n")
+	if err == nil {
+		t.Errorf("expected an error of quit, but got: %s", out)
+	}
+	out, err = interactive("n\nall\n")
+	if err != nil {
+		t.Errorf("failed to apply interactively: %s", out)
+	}
+	assertEquals(t, out, stripHeredoc(`
+		-- Apply --
+		ALTER TABLE `+"`users`"+` ADD COLUMN `+"`name`"+` text;
+		-- Run this statement? [y/n/all/quit]: -- Skipped --
+		CREATE TABLE posts (id integer);
+		-- Run this statement? [y/n/all/quit]: DROP TABLE `+"`logs`"+`;
+		`,
+	))
+
+	out, err = interactive("y\nn\n")
+	if err != nil {
+		t.Errorf("failed to apply interactively: %s", out)
+	}
+	assertEquals(t, out, stripHeredoc(`
+		-- Apply --
+		ALTER TABLE `+"`users`"+` ADD COLUMN `+"`name`"+` text;
+		-- Run this statement? [y/n/all/quit]: `,
+	))
+	writeFile("schema.sql", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY, name text);")
+	out, _ = interactive("n\n")
+	assertEquals(t, out, stripHeredoc(`
+		-- Apply --
+		DROP TABLE `+"`posts`"+`;
+		-- Run this DESTRUCTIVE statement? [y/n/all/quit]: -- Skipped --
+		`,
+	))
+}
+
+func TestSQLite3defTransaction(t *testing.T) {
+	resetTestDatabase()
+	defer os.Remove("resume.json")
+	os.Remove("resume.json")
+	mustExecute("sqlite3", "sqlite3def_test", "CREATE TABLE users (id integer); INSERT INTO users VALUES (1), (1);")
+	writeFile("schema.sql", "CREATE TABLE users (id integer, name text); CREATE UNIQUE INDEX index_id ON users (id);")
+
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--file", "schema.sql")
+	if err == nil {
+		t.Errorf("expected a failure of the unique index, but got: %s", out)
+	}
+	assertEquals(t, out, stripHeredoc(`
+		-- Apply --
+		ALTER TABLE `+"`users`"+` ADD COLUMN `+"`name`"+` text;
+		CREATE UNIQUE INDEX index_id ON users (id);
+		-- Failed: CREATE UNIQUE INDEX index_id ON users (id);
+		-- Rolled back. Nothing is applied. --
+		UNIQUE constraint failed: users.id
+		`,
+	))
+
+	out, err = execute("./sqlite3def", "sqlite3def_test", "--file", "schema.sql", "--transaction", "none", "--resume", "resume.json")
+	if err == nil {
+		t.Errorf("expected a failure of the unique index, but got: %s", out)
+	}
+	assertEquals(t, out, stripHeredoc(`
+		-- Apply --
+		ALTER TABLE `+"`users`"+` ADD COLUMN `+"`name`"+` text;
+		CREATE UNIQUE INDEX index_id ON users (id);
+		-- Failed: CREATE UNIQUE INDEX index_id ON users (id);
+		-- 1 statement(s) were applied before the failure --
+		-- Applied: ALTER TABLE `+"`users`"+` ADD COLUMN `+"`name`"+` text;
+		-- Run again with --resume=resume.json to continue from the failed statement --
+		UNIQUE constraint failed: users.id
+		`,
+	))
+	buf, err := ioutil.ReadFile("resume.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, string(buf), stripHeredoc(`
+		{
+		  "applied": [
+		    {
+		      "position": 0,
+		      "sql": "ALTER TABLE `+"`users`"+` ADD COLUMN `+"`name`"+` text"
+		    }
+		  ],
+		  "failed": "CREATE UNIQUE INDEX index_id ON users (id)"
+		}
+		`,
+	))
+
+	mustExecute("sqlite3", "sqlite3def_test", "DELETE FROM users WHERE rowid = 2;")
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--file", "schema.sql", "--transaction", "none", "--resume", "resume.json")
+	assertEquals(t, out, stripHeredoc(`
+		-- Resuming from the failed statement: CREATE UNIQUE INDEX index_id ON users (id); --
+		-- Apply --
+		CREATE UNIQUE INDEX index_id ON users (id);
+		`,
+	))
+	if _, err := os.Stat("resume.json"); !os.IsNotExist(err) {
+		t.Errorf("expected resume.json to be removed after the success, but got: %v", err)
+	}
+
+	out, err = execute("./sqlite3def", "sqlite3def_test", "--file", "schema.sql", "--transaction", "nested")
+	if err == nil || !strings.Contains(out, "invalid --transaction 'nested' (expected one of: auto, single, none)") {
+		t.Errorf("expected an invalid --transaction error, but got: %s", out)
+	}
+}
+
+func TestSQLite3defConvert(t *testing.T) {
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (
+		  id integer PRIMARY KEY AUTOINCREMENT,
+		  name text NOT NULL,
+		  active boolean DEFAULT 1
+		);
+		CREATE INDEX index_name ON users (name);
+		CREATE VIEW active_users AS SELECT id FROM users WHERE active = 1;
+		`,
+	))
+
+	out, err := execute("./sqlite3def", "--convert-to", "postgres", "--file", "schema.sql")
+	if err != nil {
+		t.Errorf("failed to convert: %s", out)
+	}
+	assertEquals(t, out, stripHeredoc(`
+		CREATE TABLE "public"."users" (
+		    "id" integer GENERATED BY DEFAULT AS IDENTITY,
+		    "name" text NOT NULL,
+		    "active" boolean DEFAULT true,
+		    PRIMARY KEY ("id")
+		);
+		CREATE INDEX "index_name" ON "public"."users" ("name");
+		CREATE VIEW "public"."active_users" AS select id from users where active = 1;
+		-- Not converted: the definition of view 'active_users' is copied without conversion
+		`,
+	))
+
+	out, err = execute("./sqlite3def", "--convert-to", "oracle", "--file", "schema.sql")
+	if err == nil || !strings.Contains(out, "unknown dialect 'oracle' (expected one of: mysql, postgres, sqlite3, mssql)") {
+		t.Errorf("expected an unknown dialect error, but got: %s", out)
+	}
+}
+
 func TestSQLite3defSkipDrop(t *testing.T) {
 	resetTestDatabase()
 	mustExecute("sqlite3", "sqlite3def_test", stripHeredoc(`
@@ -90,6 +283,361 @@ func TestSQLite3defSkipDrop(t *testing.T) {
 	assertEquals(t, skipDrop, strings.Replace(apply, "DROP", "-- Skipped: DROP", 1))
 }
 
+func TestSQLite3defSkipDropTypes(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("sqlite3", "sqlite3def_test", stripHeredoc(`
+		CREATE TABLE users (
+		    id integer NOT NULL PRIMARY KEY,
+		    age integer
+		);
+		CREATE VIEW user_ages AS SELECT age FROM users;`,
+	))
+
+	writeFile("schema.sql", "")
+
+	skipDrop := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--skip-drop=table", "--file", "schema.sql")
+	assertEquals(t, skipDrop, "-- dry run --\n-- Skipped: DROP TABLE `users`;\nDROP VIEW `user_ages`;\n")
+
+	allowDrop := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--allow-drop=view,index", "--file", "schema.sql")
+	assertEquals(t, allowDrop, skipDrop)
+
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--skip-drop=tables", "--file", "schema.sql")
+	if err == nil || !strings.Contains(out, "unknown object type 'tables'") {
+		t.Errorf("expected an unknown object type error, but got: %s", out)
+	}
+}
+
+func TestSQLite3defDetectRenames(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("sqlite3", "sqlite3def_test", stripHeredoc(`
+		CREATE TABLE users (
+		    id integer NOT NULL PRIMARY KEY,
+		    name text
+		);`,
+	))
+
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (
+		    id integer NOT NULL PRIMARY KEY,
+		    username text
+		);`,
+	))
+
+	dryRun := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema.sql")
+	assertEquals(t, dryRun, stripHeredoc(`
+		-- dry run --
+		ALTER TABLE `+"`users`"+` ADD COLUMN `+"`username`"+` text;
+		ALTER TABLE `+"`users`"+` DROP COLUMN `+"`name`"+`;
+		`,
+	))
+
+	apply := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--detect-renames", "--file", "schema.sql")
+	assertEquals(t, apply, stripHeredoc(`
+		-- Apply --
+		-- Detected rename of column 'name' to 'username'. Make sure it's not dropped and added.
+		ALTER TABLE `+"`users`"+` RENAME COLUMN `+"`name`"+` TO `+"`username`"+`;
+		`,
+	))
+	assertApplyOutput(t, stripHeredoc(`
+		CREATE TABLE users (
+		    id integer NOT NULL PRIMARY KEY,
+		    username text
+		);`,
+	), nothingModified)
+}
+
+func TestSQLite3defMultipleFiles(t *testing.T) {
+	resetTestDatabase()
+	os.MkdirAll("schema/tables", 0755)
+	defer os.RemoveAll("schema")
+	writeFile("schema/tables/users.sql", "CREATE TABLE users (\n  id integer NOT NULL PRIMARY KEY\n)\n")
+	writeFile("schema/tables/posts.sql", "-- posts\nCREATE TABLE posts (\n  id integer NOT NULL PRIMARY KEY\n);\n")
+	writeFile("schema/views.sql", "CREATE VIEW user_ids AS SELECT id FROM users;")
+	writeFile("schema/README.md", "not a schema")
+
+	expected := stripHeredoc(`
+		-- dry run --
+		CREATE TABLE posts (
+		  id integer NOT NULL PRIMARY KEY
+		);
+		CREATE TABLE users (
+		  id integer NOT NULL PRIMARY KEY
+		);
+		CREATE VIEW user_ids AS SELECT id FROM users;
+		`,
+	)
+	out := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema")
+	assertEquals(t, out, expected)
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema/**/*.sql")
+	assertEquals(t, out, expected)
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema/tables/*.sql")
+	assertEquals(t, out, strings.TrimSuffix(expected, "CREATE VIEW user_ids AS SELECT id FROM users;\n"))
+
+	writeFile("schema/tables/users_copy.sql", "\n\nCREATE TABLE users (\n  id integer NOT NULL PRIMARY KEY\n);\n")
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema")
+	expectedError := "table 'users' is doubly created (defined at schema/tables/users.sql:1 and schema/tables/users_copy.sql:3)"
+	if err == nil || !strings.Contains(out, expectedError) {
+		t.Errorf("expected an error containing '%s', but got: %s", expectedError, out)
+	}
+}
+
+func TestSQLite3defMultipleFilesEndingWithComment(t *testing.T) {
+	resetTestDatabase()
+	os.MkdirAll("schema", 0755)
+	defer os.RemoveAll("schema")
+	writeFile("schema/posts.sql", "CREATE TABLE posts (id integer)\n-- posts")
+	writeFile("schema/users.sql", "CREATE TABLE users (id integer);\n")
+
+	out := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema")
+	assertEquals(t, out, "-- dry run --\nCREATE TABLE posts (id integer);\nCREATE TABLE users (id integer);\n")
+}
+
+func TestSQLite3defEnv(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("sqlite3", "sqlite3def_test", stripHeredoc(`
+		CREATE TABLE users (
+		    id integer NOT NULL PRIMARY KEY
+		);
+		CREATE TABLE schema_migrations (
+		    version text NOT NULL
+		);`,
+	))
+	defer os.Remove("sqldef.yml")
+	writeFile("sqldef.yml", stripHeredoc(`
+		environments:
+		  test:
+		    database: sqlite3def_test
+		    files: [schema.sql]
+		    skip_drop: all
+		    exclude: [schema_migrations]
+		`,
+	))
+	writeFile("schema.sql", "CREATE TABLE posts (id integer NOT NULL PRIMARY KEY);")
+
+	out := assertedExecute(t, "./sqlite3def", "--env", "test", "--dry-run")
+	assertEquals(t, out, "-- dry run --\nCREATE TABLE posts (id integer NOT NULL PRIMARY KEY);\n-- Skipped: DROP TABLE `users`;\n")
+
+	// Options in the command line take precedence
+	out = assertedExecute(t, "./sqlite3def", "--env", "test", "--dry-run", "--skip-drop=view")
+	assertEquals(t, out, "-- dry run --\nCREATE TABLE posts (id integer NOT NULL PRIMARY KEY);\nDROP TABLE `users`;\n")
+
+	out, err := execute("./sqlite3def", "--env", "production", "--dry-run")
+	if err == nil || !strings.Contains(out, "environment 'production' is not found in 'sqldef.yml' (expected one of: test)") {
+		t.Errorf("expected an error of an unknown environment, but got: %s", out)
+	}
+}
+
+func TestSQLite3defConnectionURL(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("sqlite3", "sqlite3def_test", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);")
+	expected := "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);\n"
+
+	out := assertedExecute(t, "./sqlite3def", "file:sqlite3def_test?mode=ro", "--export")
+	assertEquals(t, out, expected)
+	out = assertedExecute(t, "./sqlite3def", "--dsn", "file:sqlite3def_test?mode=ro", "--export")
+	assertEquals(t, out, expected)
+
+	os.Setenv("DATABASE_URL", "file:sqlite3def_test?mode=ro")
+	defer os.Unsetenv("DATABASE_URL")
+	out = assertedExecute(t, "./sqlite3def", "--export")
+	assertEquals(t, out, expected)
+
+	// Query parameters are given to the driver
+	writeFile("schema.sql", "")
+	out, err := execute("./sqlite3def", "--file", "schema.sql")
+	if err == nil || !strings.Contains(out, "readonly") {
+		t.Errorf("expected a read-only database error, but got: %s", out)
+	}
+
+	out, err = execute("./sqlite3def", "postgres://localhost/sqlite3def_test", "--export")
+	if err == nil || !strings.Contains(out, "unsupported scheme 'postgres' of the connection URL (expected one of: file)") {
+		t.Errorf("expected an unsupported scheme error, but got: %s", out)
+	}
+}
+
+func TestSQLite3defDesiredDSN(t *testing.T) {
+	resetTestDatabase()
+	defer os.Remove("sqlite3def_desired")
+	os.Remove("sqlite3def_desired")
+	mustExecute("sqlite3", "sqlite3def_desired", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY, name text);")
+	mustExecute("sqlite3", "sqlite3def_test", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);")
+
+	out := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--desired-dsn", "file:sqlite3def_desired?mode=ro")
+	assertEquals(t, out, applyPrefix+"ALTER TABLE `users` ADD COLUMN `name` text;\n")
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--desired-dsn", "sqlite3def_desired")
+	assertEquals(t, out, nothingModified)
+}
+
+func TestSQLite3defIncludeExclude(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("sqlite3", "sqlite3def_test", stripHeredoc(`
+		CREATE TABLE users (
+		    id integer NOT NULL PRIMARY KEY
+		);
+		CREATE TABLE _users_gho (
+		    id integer NOT NULL PRIMARY KEY
+		);
+		CREATE TABLE jobs (
+		    id integer NOT NULL PRIMARY KEY
+		);
+		CREATE VIEW job_ids AS SELECT id FROM jobs;`,
+	))
+	writeFile("schema.sql", stripHeredoc(`
+		CREATE TABLE users (
+		    id integer NOT NULL PRIMARY KEY
+		);
+		CREATE TABLE posts (
+		    id integer NOT NULL PRIMARY KEY
+		);`,
+	))
+	defer os.Remove("exclude.txt")
+	writeFile("exclude.txt", "# queue tables\n/^jobs?$/\njob_*\n")
+
+	out := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema.sql", "--exclude", "_*_gho", "--exclude", "@exclude.txt")
+	assertEquals(t, out, "-- dry run --\nCREATE TABLE posts (\n    id integer NOT NULL PRIMARY KEY\n);\n")
+
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--dry-run", "--file", "schema.sql", "--include", "/^(users|posts)$/")
+	assertEquals(t, out, "-- dry run --\nCREATE TABLE posts (\n    id integer NOT NULL PRIMARY KEY\n);\n")
+
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--export", "--include", "users", "--include", "job_ids")
+	assertEquals(t, out, "CREATE TABLE users (\n    id integer NOT NULL PRIMARY KEY\n);\n\nCREATE VIEW job_ids AS SELECT id FROM jobs;\n")
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--export", "--include", "users")
+	assertEquals(t, out, "CREATE TABLE users (\n    id integer NOT NULL PRIMARY KEY\n);\n")
+}
+
+func TestSQLite3defPlanOut(t *testing.T) {
+	resetTestDatabase()
+	writeFile("schema.sql", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);")
+
+	dryRun := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--plan-out", "plan.json", "--file", "schema.sql")
+	assertEquals(t, dryRun, "-- dry run --\nCREATE TABLE users (id integer NOT NULL PRIMARY KEY);\n")
+
+	apply := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--apply-plan", "plan.json")
+	assertEquals(t, apply, applyPrefix+"CREATE TABLE users (id integer NOT NULL PRIMARY KEY);\n")
+
+	// The plan must not be applied twice
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--apply-plan", "plan.json")
+	if err == nil || !strings.Contains(out, "The current schema has changed") {
+		t.Errorf("expected a fingerprint mismatch error, but got: %s", out)
+	}
+}
+
+func TestSQLite3defResumeChangedPlan(t *testing.T) {
+	resetTestDatabase()
+	defer os.Remove("resume.json")
+	mustExecute("sqlite3", "sqlite3def_test", "CREATE TABLE users (id integer);")
+	writeFile("schema.sql", "CREATE TABLE users (id integer, name text); CREATE UNIQUE INDEX index_id ON users (id);")
+	writeFile("resume.json", `{"applied": [{"position": 1, "sql": "CREATE UNIQUE INDEX index_id ON users (id)"}], "failed": "DROP TABLE logs"}`)
+
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--file", "schema.sql", "--transaction", "none", "--resume", "resume.json")
+	if err == nil || !strings.Contains(out, "Failed to resume by 'resume.json': the plan has changed since the failure, and the applied statement is planned after unapplied ones: CREATE UNIQUE INDEX index_id ON users (id);") {
+		t.Errorf("expected an error of the changed plan, but got: %s", out)
+	}
+
+	// The same statement applied at another position is planned again
+	writeFile("resume.json", `{"applied": [{"position": 0, "sql": "CREATE UNIQUE INDEX index_id ON users (id)"}], "failed": "DROP TABLE logs"}`)
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--file", "schema.sql", "--transaction", "none", "--resume", "resume.json")
+	assertEquals(t, out, stripHeredoc(`
+		-- Resuming, but the failed statement is not planned anymore: DROP TABLE logs; --
+		-- Apply --
+		ALTER TABLE `+"`users`"+` ADD COLUMN `+"`name`"+` text;
+		CREATE UNIQUE INDEX index_id ON users (id);
+		`,
+	))
+}
+
+func TestSQLite3defApplyPlanResume(t *testing.T) {
+	resetTestDatabase()
+	defer os.Remove("resume.json")
+	os.Remove("resume.json")
+	mustExecute("sqlite3", "sqlite3def_test", "CREATE TABLE users (id integer); INSERT INTO users VALUES (1), (1);")
+	writeFile("schema.sql", "CREATE TABLE users (id integer); CREATE UNIQUE INDEX index_id ON users (id);")
+	assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--plan-out", "plan.json", "--file", "schema.sql")
+
+	out, err := execute("./sqlite3def", "sqlite3def_test", "--apply-plan", "plan.json", "--transaction", "none", "--resume", "resume.json")
+	if err == nil || !strings.Contains(out, "-- Run again with --resume=resume.json to continue from the failed statement --") {
+		t.Errorf("expected a failure of the unique index recorded to resume.json, but got: %s", out)
+	}
+
+	mustExecute("sqlite3", "sqlite3def_test", "DELETE FROM users WHERE rowid = 2;")
+	out = assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--apply-plan", "plan.json", "--transaction", "none", "--resume", "resume.json")
+	assertEquals(t, out, stripHeredoc(`
+		-- Resuming from the failed statement: CREATE UNIQUE INDEX index_id ON users (id); --
+		-- Apply --
+		CREATE UNIQUE INDEX index_id ON users (id);
+		`,
+	))
+	if _, err := os.Stat("resume.json"); !os.IsNotExist(err) {
+		t.Errorf("expected resume.json to be removed after the success, but got: %v", err)
+	}
+}
+
+func TestSQLite3defRunner(t *testing.T) {
+	resetTestDatabase()
+	db, err := connectDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	createTable := "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);"
+	var out bytes.Buffer
+	runner := sqldef.NewRunner(schema.GeneratorModeSQLite3, db, sqldef.Options{DesiredDDLs: createTable}, &out)
+	result, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Applied || len(result.Plan) != 1 {
+		t.Errorf("expected the plan to be applied, but got: %#v", result)
+	}
+	assertEquals(t, out.String(), applyPrefix+"CREATE TABLE users (id integer NOT NULL PRIMARY KEY);\n")
+
+	runner = sqldef.NewRunner(schema.GeneratorModeSQLite3, db, sqldef.Options{DesiredDDLs: "CREATE TABLE users (id integer,);"}, &out)
+	if _, err := runner.Run(context.Background()); err == nil {
+		t.Error("expected a syntax error to be returned")
+	}
+}
+
+func TestSQLite3defRunnerPlan(t *testing.T) {
+	resetTestDatabase()
+	mustExecute("sqlite3", "sqlite3def_test", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY, age integer); CREATE TABLE bigdata (data integer);")
+	db, err := connectDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	desired := "CREATE TABLE users (id integer NOT NULL PRIMARY KEY, age integer, name text);"
+	runner := sqldef.NewRunner(schema.GeneratorModeSQLite3, db, sqldef.Options{DesiredDDLs: desired, DryRun: true}, nil)
+	result, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := schema.Plan{
+		{Kind: schema.ChangeKindCreate, ObjectType: schema.ObjectTypeColumn, Table: "users", Column: "name", SQL: "ALTER TABLE `users` ADD COLUMN `name` text"},
+		{Kind: schema.ChangeKindDrop, ObjectType: schema.ObjectTypeTable, Table: "bigdata", Destructive: true, SQL: "DROP TABLE `bigdata`"},
+	}
+	if !reflect.DeepEqual(result.Plan, expected) {
+		t.Errorf("expected %#v but got %#v", expected, result.Plan)
+	}
+}
+
+func TestSQLite3defRunnerCanceled(t *testing.T) {
+	resetTestDatabase()
+	db, err := connectDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runner := sqldef.NewRunner(schema.GeneratorModeSQLite3, db, sqldef.Options{DesiredDDLs: "CREATE TABLE users (id integer);"}, nil)
+	if _, err := runner.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled but got: %v", err)
+	}
+}
+
 func TestSQLite3defExport(t *testing.T) {
 	resetTestDatabase()
 	out := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "--export")
@@ -111,6 +659,27 @@ func TestSQLite3defExport(t *testing.T) {
 	))
 }
 
+func TestSQLite3defSharedOptions(t *testing.T) {
+	resetTestDatabase()
+	writeFile("schema.sql", "CREATE TABLE users (id integer NOT NULL PRIMARY KEY);")
+
+	// Options of other commands are available too
+	out := assertedExecute(t, "./sqlite3def", "sqlite3def_test", "-f", "schema.sql", "--before-apply", "CREATE TABLE logs (id integer);", "--exclude", "logs")
+	assertEquals(t, out, applyPrefix+"CREATE TABLE logs (id integer);\nCREATE TABLE users (id integer NOT NULL PRIMARY KEY);\n")
+
+	// except those meaningless for SQLite3
+	out, err := execute("./sqlite3def", "sqlite3def_test", "-f", "schema.sql", "--host", "127.0.0.1")
+	if err == nil || !strings.Contains(out, "--host is not supported by sqlite3") {
+		t.Errorf("expected an error of --host, but got: %s", out)
+	}
+	writeFile("sqldef.yml", "environments:\n  test:\n    database: sqlite3def_test\n    schemas: [public]\n")
+	defer os.Remove("sqldef.yml")
+	out, err = execute("./sqlite3def", "--env", "test", "-f", "schema.sql")
+	if err == nil || !strings.Contains(out, "'schema' of the environment is not supported by this command") {
+		t.Errorf("expected an error of schemas, but got: %s", out)
+	}
+}
+
 func TestSQLite3defHelp(t *testing.T) {
 	_, err := execute("./sqlite3def", "--help")
 	if err != nil {
@@ -130,6 +699,7 @@ func TestMain(m *testing.M) {
 	_ = os.Remove("sqlite3def")
 	_ = os.Remove("sqlite3def_test")
 	_ = os.Remove("schema.sql")
+	_ = os.Remove("plan.json")
 	os.Exit(status)
 }
 
@@ -2,6 +2,7 @@
 package testutils
 
 import (
+	"context"
 	"fmt"
 	"github.com/k0kubun/sqldef/adapter"
 	"github.com/k0kubun/sqldef/schema"
@@ -78,7 +79,7 @@ func RunTest(t *testing.T, db adapter.Database, test TestCase, mode schema.Gener
 	}
 
 	// Test idempotency
-	dumpDDLs, err := adapter.DumpDDLs(db)
+	dumpDDLs, err := adapter.DumpDDLs(context.Background(), db)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -91,7 +92,7 @@ func RunTest(t *testing.T, db adapter.Database, test TestCase, mode schema.Gener
 	}
 
 	// Main test
-	dumpDDLs, err = adapter.DumpDDLs(db)
+	dumpDDLs, err = adapter.DumpDDLs(context.Background(), db)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -110,7 +111,7 @@ func RunTest(t *testing.T, db adapter.Database, test TestCase, mode schema.Gener
 	}
 
 	// Test idempotency
-	dumpDDLs, err = adapter.DumpDDLs(db)
+	dumpDDLs, err = adapter.DumpDDLs(context.Background(), db)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -156,7 +157,7 @@ func compareVersion(t *testing.T, leftVersion string, rightVersion string) int {
 }
 
 func splitDDLs(mode schema.GeneratorMode, str string) ([]string, error) {
-	statements, err := schema.ParseDDLs(mode, str)
+	statements, err := schema.ParseDDLs(mode, "public", str)
 	if err != nil {
 		return nil, err
 	}
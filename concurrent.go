@@ -0,0 +1,64 @@
+package sqldef
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/k0kubun/sqldef/adapter"
+	"github.com/k0kubun/sqldef/schema"
+)
+
+// Return DDLs dropping INVALID indexes left by failed CREATE INDEX CONCURRENTLY, which should run before
+// re-creating them. They're not dumped as the current schema. Only indexes created by the plan on managed
+// tables are dropped, so that a concurrent build still running in another session is not dropped.
+func (r *Runner) invalidIndexDrops(ctx context.Context, plan schema.Plan) ([]adapter.DDL, error) {
+	dropper, ok := r.DB.(adapter.InvalidIndexDropper)
+	if !ok {
+		return nil, nil
+	}
+	drops, err := dropper.InvalidIndexDrops(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find INVALID indexes: %w", err)
+	}
+	filter, err := r.Options.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	type index struct{ table, name string }
+	created := map[index]bool{}
+	for _, change := range plan {
+		if change.ObjectType == schema.ObjectTypeIndex && change.Kind == schema.ChangeKindCreate {
+			created[index{table: change.Table, name: change.Name}] = true
+		}
+	}
+
+	var ddls []adapter.DDL
+	for _, drop := range drops {
+		if (filter != nil && !filter(drop.Table)) || !created[index{table: drop.Table, name: drop.Index}] {
+			continue
+		}
+		ddls = append(ddls, adapter.DDL{
+			SQL:           drop.SQL,
+			Comment:       "Drop the INVALID index left by a failed CREATE INDEX CONCURRENTLY",
+			NoTransaction: true,
+		})
+	}
+	return ddls, nil
+}
+
+// Drop INVALID indexes right after CREATE INDEX CONCURRENTLY of the plan fails
+func (r *Runner) dropInvalidIndexes(ctx context.Context, plan schema.Plan, out io.Writer) error {
+	ddls, err := r.invalidIndexDrops(ctx, plan)
+	if err != nil {
+		return err
+	}
+	for _, ddl := range ddls {
+		if _, err := r.DB.DB().ExecContext(ctx, ddl.SQL); err != nil {
+			return fmt.Errorf("Failed to drop the INVALID index: %w", err)
+		}
+		fmt.Fprintf(out, "-- Dropped the INVALID index left by the failure: %s --\n", ddl.Statement())
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package sqldef
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v2"
+)
+
+// Content of a config file given by --config, sqldef.yml by default
+type ConfigFile struct {
+	Environments map[string]Environment `yaml:"environments"`
+}
+
+// How a database is managed, selected by --env
+type Environment struct {
+	// adapter.Config
+	DSN                   string `yaml:"dsn"`         // Connection URL instead of the following fields. ${VAR} is expanded too.
+	DesiredDSN            string `yaml:"desired_dsn"` // Value of --desired-dsn. ${VAR} is expanded too.
+	Database              string `yaml:"database"`
+	User                  string `yaml:"user"`
+	Password              string `yaml:"password"` // ${VAR} is expanded with the environment variable
+	Host                  string `yaml:"host"`
+	Port                  int    `yaml:"port"`
+	Socket                string `yaml:"socket"`
+	EnableCleartextPlugin bool   `yaml:"enable_cleartext_plugin"`
+	SSLMode               string `yaml:"ssl_mode"`
+	SSLCA                 string `yaml:"ssl_ca"`
+	SSLCert               string `yaml:"ssl_cert"`
+	SSLKey                string `yaml:"ssl_key"`
+	SSLServerName         string `yaml:"ssl_server_name"`
+	// Values of --schema and --default-schema
+	Schemas       []string `yaml:"schemas"`
+	DefaultSchema string   `yaml:"default_schema"`
+
+	// Values of --file
+	Files []string `yaml:"files"`
+	// Values of --skip-drop and --allow-drop
+	SkipDrop    string `yaml:"skip_drop"`
+	AllowDrop   string `yaml:"allow_drop"`
+	BeforeApply string `yaml:"before_apply"`
+	// Values of --include and --exclude
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func LoadEnvironment(path string, name string) (*Environment, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config ConfigFile
+	if err := yaml.UnmarshalStrict(buf, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+
+	env, ok := config.Environments[name]
+	if !ok {
+		var names []string
+		for name := range config.Environments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("environment '%s' is not found in '%s' (expected one of: %s)", name, path, strings.Join(names, ", "))
+	}
+	env.DSN = os.ExpandEnv(env.DSN)
+	env.DesiredDSN = os.ExpandEnv(env.DesiredDSN)
+	env.Password = os.ExpandEnv(env.Password)
+	return &env, nil
+}
+
+// Set values of the environment to the options which are not given in the command line.
+// opts is the struct given to flags.NewParser, and args are its positional arguments.
+// It returns args with the database name if no database is given.
+func (e *Environment) SetOptions(parser *flags.Parser, opts interface{}, args []string) ([]string, error) {
+	values := map[string]interface{}{}
+	if e.DSN != "" {
+		values["dsn"] = e.DSN
+	}
+	if e.DesiredDSN != "" {
+		values["desired-dsn"] = e.DesiredDSN
+	}
+	if e.User != "" {
+		values["user"] = e.User
+	}
+	if e.Password != "" {
+		values["password"] = e.Password
+	}
+	if e.Host != "" {
+		values["host"] = e.Host
+	}
+	if e.Port != 0 {
+		values["port"] = e.Port
+	}
+	if e.Socket != "" {
+		values["socket"] = e.Socket
+	}
+	if e.EnableCleartextPlugin {
+		values["enable-cleartext-plugin"] = e.EnableCleartextPlugin
+	}
+	if e.SSLMode != "" {
+		values["ssl-mode"] = e.SSLMode
+	}
+	if e.SSLCA != "" {
+		values["ssl-ca"] = e.SSLCA
+	}
+	if e.SSLCert != "" {
+		values["ssl-cert"] = e.SSLCert
+	}
+	if e.SSLKey != "" {
+		values["ssl-key"] = e.SSLKey
+	}
+	if e.SSLServerName != "" {
+		values["ssl-server-name"] = e.SSLServerName
+	}
+	if len(e.Schemas) > 0 {
+		values["schema"] = e.Schemas
+	}
+	if e.DefaultSchema != "" {
+		values["default-schema"] = e.DefaultSchema
+	}
+	if len(e.Files) > 0 {
+		values["file"] = e.Files
+	}
+	if e.SkipDrop != "" {
+		values["skip-drop"] = e.SkipDrop
+	}
+	if e.AllowDrop != "" {
+		values["allow-drop"] = e.AllowDrop
+	}
+	if e.BeforeApply != "" {
+		values["before-apply"] = e.BeforeApply
+	}
+	if len(e.Include) > 0 {
+		values["include"] = e.Include
+	}
+	if len(e.Exclude) > 0 {
+		values["exclude"] = e.Exclude
+	}
+
+	unknown, err := SetDefaultOptions(parser, opts, values)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("'%s' of the environment is not supported by this command", strings.ReplaceAll(unknown[0], "-", "_"))
+	}
+
+	if len(args) == 0 && e.Database != "" {
+		args = []string{e.Database}
+	}
+	return args, nil
+}
+
+// Set values to the options which are not given in the command line. Keys of values are long option names,
+// and string values are converted to the types of options. opts is the struct given to flags.NewParser.
+// It returns the sorted names of values which are not options of the command or hidden ones.
+func SetDefaultOptions(parser *flags.Parser, opts interface{}, values map[string]interface{}) ([]string, error) {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var unknown []string
+	fields := reflect.ValueOf(opts).Elem()
+	for _, name := range names {
+		option := parser.FindOptionByLongName(name)
+		if option == nil || option.Hidden { // hidden options are not supported by the dialect
+			unknown = append(unknown, name)
+			continue
+		}
+		if option.IsSet() && !option.IsSetDefault() {
+			continue // the command line takes precedence
+		}
+
+		field := fields.FieldByName(option.Field().Name)
+		value := reflect.ValueOf(values[name])
+		if str, ok := values[name].(string); ok && field.Kind() != reflect.String {
+			var err error
+			if value, err = parseOptionValue(str, field.Type()); err != nil {
+				return nil, fmt.Errorf("invalid value '%s' of '%s': %w", str, name, err)
+			}
+		}
+		field.Set(value.Convert(field.Type()))
+	}
+	return unknown, nil
+}
+
+func parseOptionValue(str string, typ reflect.Type) (reflect.Value, error) {
+	switch typ.Kind() {
+	case reflect.Bool:
+		switch strings.ToLower(str) {
+		case "", "1", "true", "on":
+			return reflect.ValueOf(true), nil
+		case "0", "false", "off":
+			return reflect.ValueOf(false), nil
+		}
+		return reflect.Value{}, fmt.Errorf("not a boolean")
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		if typ == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(str)
+			return reflect.ValueOf(d), err
+		}
+		n, err := strconv.ParseUint(str, 10, 64)
+		return reflect.ValueOf(n), err
+	case reflect.Slice:
+		return reflect.ValueOf([]string{str}), nil
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %s", typ)
+	}
+}
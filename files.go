@@ -0,0 +1,139 @@
+package sqldef
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/k0kubun/sqldef/schema"
+)
+
+// Read and concatenate schema files given by a --file value, which is a file, "-" for stdin,
+// a directory to read all .sql files in it recursively, or a glob pattern which may contain "**".
+// Files are concatenated in the lexical order of their paths, and the returned SourceFiles tell
+// which part of the SQL comes from which file.
+func ReadFiles(pattern string) (string, []schema.SourceFile, error) {
+	if pattern == "-" {
+		sql, err := ReadFile(pattern)
+		return sql, nil, err
+	}
+
+	paths, err := expandFiles(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sql strings.Builder
+	var files []schema.SourceFile
+	for _, path := range paths {
+		content, err := ReadFile(path)
+		if err != nil {
+			return "", nil, err
+		}
+		files = append(files, schema.SourceFile{Name: path, Offset: sql.Len()})
+		sql.WriteString(content)
+		// Don't let the last DDL of a file be joined with the first DDL of the next file.
+		// The semicolon is put on a new line, since the file may end with a `--` comment.
+		if trimmed := strings.TrimSpace(content); trimmed != "" && !strings.HasSuffix(trimmed, ";") {
+			sql.WriteString("\n;\n")
+		} else if !strings.HasSuffix(content, "\n") {
+			sql.WriteString("\n")
+		}
+	}
+	return sql.String(), files, nil
+}
+
+func expandFiles(pattern string) ([]string, error) {
+	var paths []string
+	if !hasGlobMeta(pattern) {
+		stat, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			return []string{pattern}, nil
+		}
+		paths, err = globFiles(filepath.Join(pattern, "**", "*.sql"))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if paths, err = globFiles(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no schema file matches '%s'", pattern)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// filepath.Glob with "**" matching zero or more directories. Directories are not returned.
+func globFiles(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err // validate the pattern
+	}
+
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	root := "."
+	if filepath.IsAbs(pattern) {
+		root = string(filepath.Separator)
+	}
+	// Walk only the directory that has no meta characters
+	for len(segments) > 1 && !hasGlobMeta(segments[0]) {
+		root = filepath.Join(root, segments[0])
+		segments = segments[1:]
+	}
+
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments, strings.Split(filepath.ToSlash(rel), "/")) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return paths, err
+}
+
+func matchSegments(patterns []string, names []string) bool {
+	if len(patterns) == 0 {
+		return len(names) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(patterns[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	if matched, _ := filepath.Match(patterns[0], names[0]); !matched {
+		return false
+	}
+	return matchSegments(patterns[1:], names[1:])
+}
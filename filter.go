@@ -0,0 +1,124 @@
+package sqldef
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Build a filter of object names from Include and Exclude, or return nil if they're empty.
+// A pattern matches the whole name, or the name without its schema, e.g. "users" for "public.users".
+func (o Options) filter() (func(string) bool, error) {
+	if len(o.Include) == 0 && len(o.Exclude) == 0 {
+		return nil, nil
+	}
+	include, err := compilePatterns(o.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(o.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string) bool {
+		if len(include) > 0 && !matchName(include, name) {
+			return false
+		}
+		return !matchName(exclude, name)
+	}, nil
+}
+
+// Compile patterns of --include and --exclude:
+//   - `/regexp/` is a regular expression that matches a part of the name unless it's anchored
+//   - `@file` reads patterns from the file, one per line, ignoring empty lines and `#` comments
+//   - others are globs that match the whole name with `*`, `?` and `[...]`
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "@") {
+			filePatterns, err := readPatternFile(strings.TrimPrefix(pattern, "@"))
+			if err != nil {
+				return nil, err
+			}
+			fileRes, err := compilePatterns(filePatterns)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, fileRes...)
+			continue
+		}
+
+		var expr string
+		if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			expr = pattern[1 : len(pattern)-1]
+		} else {
+			expr = globToRegexp(pattern)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end >= 0 {
+				class := glob[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				expr.WriteString("[" + class + "]")
+				i += end + 1
+			} else {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
+
+func readPatternFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+func matchName(patterns []*regexp.Regexp, name string) bool {
+	unqualified := name[strings.LastIndex(name, ".")+1:]
+	for _, re := range patterns {
+		if re.MatchString(name) || re.MatchString(unqualified) {
+			return true
+		}
+	}
+	return false
+}
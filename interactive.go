@@ -0,0 +1,59 @@
+package sqldef
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/k0kubun/sqldef/adapter"
+)
+
+// Return an adapter.Confirm of --interactive, which asks y/n/all/quit for each DDL.
+// "all" runs the rest without asking, and "quit" aborts the rest.
+func interactiveConfirm(in io.Reader, out io.Writer) adapter.Confirm {
+	reader := bufio.NewReader(in)
+	all := false
+	return func(ddl adapter.DDL) (bool, error) {
+		if all {
+			return true, nil
+		}
+		for {
+			if ddl.Destructive {
+				fmt.Fprint(out, "-- Run this DESTRUCTIVE statement? [y/n/all/quit]: ")
+			} else {
+				fmt.Fprint(out, "-- Run this statement? [y/n/all/quit]: ")
+			}
+			answer, err := reader.ReadString('\n')
+			if err != nil && (err != io.EOF || answer == "") {
+				fmt.Fprintln(out)
+				return false, fmt.Errorf("Failed to read the answer: %w", err)
+			}
+
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				return true, nil
+			case "n", "no":
+				return false, nil
+			case "a", "all":
+				all = true
+				return true, nil
+			case "q", "quit":
+				return false, fmt.Errorf("Aborted by the user")
+			}
+		}
+	}
+}
+
+// Return where answers of --interactive are read. It's stdin unless the schema is read from stdin.
+func interactiveInput(options *Options) (io.Reader, func(), error) {
+	if options.DesiredFile != "-" || options.DesiredDB != nil || options.DesiredDDLs != "" || options.ApplyPlan != "" {
+		return os.Stdin, func() {}, nil
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, nil, fmt.Errorf("--interactive needs a terminal when the schema is given by stdin: %w", err)
+	}
+	return tty, func() { tty.Close() }, nil
+}
@@ -0,0 +1,270 @@
+package sqldef
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/k0kubun/sqldef/adapter"
+	"github.com/k0kubun/sqldef/schema"
+)
+
+// Tools which run MySQL's ALTER TABLE by copying the table online
+var onlineSchemaChangeTools = []string{"gh-ost", "pt-online-schema-change"}
+
+// How ALTER TABLE of large MySQL tables is converted to commands of an online schema change tool
+type OnlineSchemaChange struct {
+	Tool    string         // "gh-ost" or "pt-online-schema-change"
+	MinSize int64          // Tables whose data and indexes are this size in bytes or larger are altered by Tool
+	Args    []string       // Extra arguments given to Tool
+	Execute bool           // Run Tool instead of just showing the command
+	Config  adapter.Config // Connection given to Tool
+}
+
+// Set Options.OnlineSchemaChange from values of --online-schema-change and its options.
+// Nothing is set if the tool is empty. Config must be set after the connection is known.
+func (o *Options) ParseOnlineSchemaChange(tool string, minSize string, args string, execute bool) error {
+	if tool == "" {
+		return nil
+	}
+	if !containsString(onlineSchemaChangeTools, tool) {
+		return fmt.Errorf("invalid --online-schema-change '%s' (expected one of: %s)", tool, strings.Join(onlineSchemaChangeTools, ", "))
+	}
+	size, err := parseSize(minSize)
+	if err != nil {
+		return fmt.Errorf("invalid --online-schema-change-size: %w", err)
+	}
+	o.OnlineSchemaChange = &OnlineSchemaChange{
+		Tool:    tool,
+		MinSize: size,
+		Args:    strings.Fields(args),
+		Execute: execute,
+	}
+	return nil
+}
+
+var sizeFormat = regexp.MustCompile(`^(\d+)\s*([KMGT]?)(?:i?B)?$`)
+
+// Parse a size such as "500M" or "1GB" in bytes, whose units are powers of 1024
+func parseSize(str string) (int64, error) {
+	match := sizeFormat.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(str)))
+	if match == nil {
+		return 0, fmt.Errorf("unknown size '%s' (expected bytes or a number with K, M, G or T, e.g. 500M)", str)
+	}
+	size, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if match[2] != "" {
+		size <<= 10 * uint(strings.Index("KMGT", match[2])+1)
+	}
+	return size, nil
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+var (
+	alterTableFormat = regexp.MustCompile(`(?s)^ALTER TABLE (\S+) (.+)$`)
+	// ALGORITHM= and LOCK= of --algorithm and --lock, which the tools don't accept
+	alterOptionsFormat = regexp.MustCompile(`(?:, ALGORITHM=[A-Z]+)?(?:, LOCK=[A-Z]+)?$`)
+)
+
+// Replace ALTER TABLE of tables larger than OnlineSchemaChange.MinSize with commands of the tool. Consecutive
+// ALTER TABLE of the same table are grouped to a command, not to reorder them across other DDLs.
+// `ddls` must be built from `plan` in the same order.
+func (r *Runner) onlineSchemaChangeDDLs(ctx context.Context, ddls []adapter.DDL, plan schema.Plan) ([]adapter.DDL, error) {
+	osc := r.Options.OnlineSchemaChange
+	sizer, ok := r.DB.(adapter.TableSizer)
+	if !ok {
+		return nil, fmt.Errorf("--online-schema-change needs sizes of tables in a MySQL database")
+	}
+	sizes, err := sizer.TableSizes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get sizes of tables: %w", err)
+	}
+
+	type alterGroup struct {
+		table    string
+		alters   []string // Bodies of ALTER TABLE
+		position int      // Index of the command in converted
+	}
+	var converted []adapter.DDL
+	var groups []*alterGroup
+	var last *alterGroup // The group of the previous DDL, which an ALTER TABLE of the same table joins
+	for i, ddl := range ddls {
+		change := plan[i]
+		match := alterTableFormat.FindStringSubmatch(ddl.SQL)
+		// Foreign keys are left to ALTER TABLE, since gh-ost doesn't support them
+		if ddl.Skip || match == nil || change.ObjectType == schema.ObjectTypeTable || change.ObjectType == schema.ObjectTypeForeignKey ||
+			sizes[change.Table] < osc.MinSize {
+			converted = append(converted, ddl)
+			last = nil
+			continue
+		}
+
+		if last == nil || last.table != change.Table {
+			last = &alterGroup{table: change.Table, position: len(converted)}
+			groups = append(groups, last)
+			converted = append(converted, adapter.DDL{})
+		}
+		last.alters = append(last.alters, alterOptionsFormat.ReplaceAllString(match[2], ""))
+		converted[last.position].Destructive = converted[last.position].Destructive || ddl.Destructive
+	}
+
+	if len(groups) > 0 && osc.Tool == "gh-ost" && osc.Config.Socket != "" {
+		return nil, fmt.Errorf("gh-ost doesn't connect by a socket, so give --host and --port instead of --socket")
+	}
+	var optionFile string
+	if len(groups) > 0 && osc.Execute {
+		if optionFile, err = osc.writeOptionFile(); err != nil {
+			return nil, fmt.Errorf("Failed to write the option file of %s: %w", osc.Tool, err)
+		}
+		r.tempFiles = append(r.tempFiles, optionFile)
+	}
+
+	for _, group := range groups {
+		command := osc.command(group.table, strings.Join(group.alters, ", "), optionFile)
+		ddl := &converted[group.position]
+		ddl.SQL = shellJoin(command)
+		ddl.Command = command
+		ddl.Comment = fmt.Sprintf("Online schema change of '%s' (%s) by %s", group.table, formatSize(sizes[group.table]), osc.Tool)
+		if !osc.Execute {
+			ddl.Comment += ". Run it by yourself, or give --online-schema-change-execute."
+			ddl.Skip = true
+		}
+	}
+	return converted, nil
+}
+
+// Return the arguments of the tool altering the table. The password is read from optionFile if not empty,
+// not to show it in the arguments.
+func (o *OnlineSchemaChange) command(table string, alter string, optionFile string) []string {
+	config := o.Config
+	tls := o.tlsMode() != ""
+	switch o.Tool {
+	case "gh-ost":
+		command := []string{o.Tool, fmt.Sprintf("--host=%s", config.Host), fmt.Sprintf("--port=%d", config.Port),
+			fmt.Sprintf("--user=%s", config.User)}
+		if optionFile != "" {
+			command = append(command, fmt.Sprintf("--conf=%s", optionFile))
+		}
+		if tls {
+			command = append(command, "--ssl")
+			if config.SSLCA != "" {
+				command = append(command, fmt.Sprintf("--ssl-ca=%s", config.SSLCA))
+			} else if o.tlsMode() == "require" {
+				command = append(command, "--ssl-allow-insecure") // "require" doesn't verify the server without a CA
+			}
+			if config.SSLCert != "" {
+				command = append(command, fmt.Sprintf("--ssl-cert=%s", config.SSLCert), fmt.Sprintf("--ssl-key=%s", config.SSLKey))
+			}
+		}
+		command = append(command, fmt.Sprintf("--database=%s", config.DbName), fmt.Sprintf("--table=%s", table),
+			fmt.Sprintf("--alter=%s", alter))
+		command = append(command, o.Args...)
+		return append(command, "--execute")
+	default: // pt-online-schema-change
+		dsn := fmt.Sprintf("h=%s,P=%d,u=%s", config.Host, config.Port, config.User)
+		if config.Socket != "" {
+			dsn = fmt.Sprintf("S=%s,u=%s", config.Socket, config.User)
+		}
+		if optionFile != "" {
+			dsn += fmt.Sprintf(",F=%s", optionFile) // which has the certificates as well
+		}
+		if tls {
+			dsn += ",s=1"
+		}
+		dsn += fmt.Sprintf(",D=%s,t=%s", config.DbName, table)
+		command := []string{o.Tool, fmt.Sprintf("--alter=%s", alter)}
+		command = append(command, o.Args...)
+		return append(command, "--execute", dsn)
+	}
+}
+
+// Return the SSL mode of Config if it enables TLS like the MySQL adapter does, or an empty string otherwise
+func (o *OnlineSchemaChange) tlsMode() string {
+	mode := adapter.NormalizeSSLMode(o.Config.SSLMode)
+	if mode == "" && (o.Config.SSLCA != "" || o.Config.SSLCert != "") {
+		mode = "require"
+	}
+	switch mode {
+	case "require", "verify-ca", "verify-full":
+		return mode
+	default:
+		return ""
+	}
+}
+
+// Write the user, the password and the certificates of Config to a temporary MySQL option file,
+// which only the current user can read, and return its path
+func (o *OnlineSchemaChange) writeOptionFile() (string, error) {
+	options := []string{"[client]", fmt.Sprintf("user=%s", optionValue(o.Config.User))}
+	if o.Config.Password != "" {
+		options = append(options, fmt.Sprintf("password=%s", optionValue(o.Config.Password)))
+	}
+	if o.tlsMode() != "" {
+		for _, option := range []struct{ name, value string }{
+			{"ssl-ca", o.Config.SSLCA}, {"ssl-cert", o.Config.SSLCert}, {"ssl-key", o.Config.SSLKey},
+		} {
+			if option.value != "" {
+				options = append(options, fmt.Sprintf("%s=%s", option.name, optionValue(option.value)))
+			}
+		}
+	}
+
+	file, err := ioutil.TempFile("", "sqldef-*.cnf") // created with 0600
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.Join(options, "\n") + "\n"); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// Quote a value of an option file, escaping backslashes and double quotes
+func optionValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_=,./:@%+-]+$`)
+
+// Join arguments into a command line which can be pasted to a shell
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
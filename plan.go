@@ -0,0 +1,59 @@
+package sqldef
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/k0kubun/sqldef/schema"
+)
+
+// Content of a file written by --plan-out and executed by --apply-plan
+type PlanFile struct {
+	// Fingerprint of the current schema that the plan was generated against
+	Fingerprint string `json:"fingerprint"`
+	BeforeApply string `json:"before_apply,omitempty"`
+	// Changes to be executed. Changes skipped by --skip-drop or --allow-drop are not included.
+	Changes schema.Plan `json:"changes"`
+}
+
+// Identify a dumped schema to detect changes made after a plan was generated
+func Fingerprint(currentDDLs string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(currentDDLs)))
+}
+
+func writePlanFile(path string, currentDDLs string, plan schema.Plan, options Options) error {
+	planFile := PlanFile{
+		Fingerprint: Fingerprint(currentDDLs),
+		BeforeApply: options.BeforeApply,
+		Changes:     schema.Plan{},
+	}
+	for i, ddl := range buildDDLs(plan, options) {
+		if !ddl.Skip {
+			planFile.Changes = append(planFile.Changes, plan[i])
+		}
+	}
+
+	buf, err := json.MarshalIndent(planFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(buf, '\n'), 0644)
+}
+
+func readPlanFile(path string) (*PlanFile, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var planFile PlanFile
+	if err := json.Unmarshal(buf, &planFile); err != nil {
+		return nil, err
+	}
+	if planFile.Fingerprint == "" {
+		return nil, fmt.Errorf("no fingerprint is found")
+	}
+	return &planFile, nil
+}
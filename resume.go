@@ -0,0 +1,109 @@
+package sqldef
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/k0kubun/sqldef/adapter"
+)
+
+// Content of a file written by --resume when DDLs fail halfway without a transaction
+type ResumeFile struct {
+	// DDLs applied before failures, accumulated over retries
+	Applied []AppliedDDL `json:"applied"`
+	// The DDL which failed last time
+	Failed string `json:"failed"`
+}
+
+// A DDL applied before a failure. The position tells apart the same statements planned more than once.
+type AppliedDDL struct {
+	Position int    `json:"position"` // Index in the planned DDLs
+	SQL      string `json:"sql"`
+}
+
+// Return nil if the file doesn't exist, i.e. the last run didn't fail
+func readResumeFile(path string) (*ResumeFile, error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var resumeFile ResumeFile
+	if err := json.Unmarshal(buf, &resumeFile); err != nil {
+		return nil, err
+	}
+	return &resumeFile, nil
+}
+
+func writeResumeFile(path string, resumeFile *ResumeFile) error {
+	buf, err := json.MarshalIndent(resumeFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(buf, '\n'), 0644)
+}
+
+// Remove DDLs applied by the failed runs from the re-planned DDLs, which happens when the dumped schema
+// doesn't reflect them, and tell whether the failed DDL is still planned. The applied DDLs must be planned
+// at the same positions before the others, and it fails otherwise since the plan has changed since the failure.
+// It also returns the positions of the remaining DDLs in the planned ones.
+func (f *ResumeFile) resume(ddls []adapter.DDL, out io.Writer) ([]adapter.DDL, []int, error) {
+	applied := map[AppliedDDL]bool{}
+	for _, ddl := range f.Applied {
+		applied[ddl] = true
+	}
+
+	var resumed []adapter.DDL
+	var positions []int
+	matching := true // True while the DDLs so far are applied or skipped
+	failedPlanned := false
+	for i, ddl := range ddls {
+		if !ddl.Skip { // skipped DDLs are not recorded
+			if applied[AppliedDDL{Position: i, SQL: ddl.SQL}] {
+				if !matching {
+					return nil, nil, fmt.Errorf("the plan has changed since the failure, and the applied statement is planned after unapplied ones: %s", ddl.Statement())
+				}
+				continue
+			}
+			matching = false
+		}
+		if ddl.SQL == f.Failed {
+			failedPlanned = true
+		}
+		resumed = append(resumed, ddl)
+		positions = append(positions, i)
+	}
+
+	if failedPlanned {
+		fmt.Fprintf(out, "-- Resuming from the failed statement: %s; --\n", f.Failed)
+	} else {
+		fmt.Fprintf(out, "-- Resuming, but the failed statement is not planned anymore: %s; --\n", f.Failed)
+	}
+	return resumed, positions, nil
+}
+
+// Return the applied DDLs with their positions in the planned DDLs. ddls are the DDLs given to adapter.RunDDLs,
+// which applies them in order, and positions are their positions in the planned DDLs, or -1 if not planned.
+func appliedDDLs(ddls []adapter.DDL, positions []int, applied []adapter.DDL) []AppliedDDL {
+	var result []AppliedDDL
+	i := 0
+	for _, ddl := range applied {
+		// A fallback replaces the SQL of the applied DDL
+		for i < len(ddls) && (ddls[i].Skip || (ddls[i].SQL != ddl.SQL && !containsString(ddls[i].Fallbacks, ddl.SQL))) {
+			i++
+		}
+		if i == len(ddls) {
+			break
+		}
+		if positions[i] >= 0 {
+			result = append(result, AppliedDDL{Position: positions[i], SQL: ddls[i].SQL})
+		}
+		i++
+	}
+	return result
+}
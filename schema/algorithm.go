@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Values of MySQL's ALGORITHM= and LOCK= clauses of ALTER TABLE
+var (
+	mysqlAlgorithms = []string{"DEFAULT", "INSTANT", "INPLACE", "COPY"}
+	mysqlLocks      = []string{"DEFAULT", "NONE", "SHARED", "EXCLUSIVE"}
+)
+
+// Parse a comma-separated list of MySQL's ALGORITHM= values such as "INSTANT,INPLACE", which are tried in order.
+func ParseAlgorithms(list string) ([]string, error) {
+	var algorithms []string
+	for _, name := range strings.Split(list, ",") {
+		algorithm := strings.ToUpper(strings.TrimSpace(name))
+		if !containsString(mysqlAlgorithms, algorithm) {
+			return nil, fmt.Errorf("unknown algorithm '%s' (expected one of: %s)", name, strings.Join(mysqlAlgorithms, ", "))
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+	return algorithms, nil
+}
+
+// Parse MySQL's LOCK= value such as "NONE"
+func ParseLock(name string) (string, error) {
+	lock := strings.ToUpper(strings.TrimSpace(name))
+	if !containsString(mysqlLocks, lock) {
+		return "", fmt.Errorf("unknown lock '%s' (expected one of: %s)", name, strings.Join(mysqlLocks, ", "))
+	}
+	return lock, nil
+}
+
+var alterAnnotation = regexp.MustCompile(`@(algorithm|lock)=(\S+)`)
+
+// Set `algorithms` and `lock` of the table with `-- @algorithm=INSTANT,INPLACE @lock=NONE`
+// at the end of the `CREATE TABLE` line.
+func parseAlterAnnotations(ddl string, table *Table) error {
+	for _, line := range strings.Split(ddl, "\n") {
+		comment := strings.Index(line, "--")
+		if comment < 0 {
+			continue
+		}
+		matches := alterAnnotation.FindAllStringSubmatch(line[comment:], -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line[:comment])), "CREATE TABLE") {
+			return fmt.Errorf("'@%s=' must be put on a line of CREATE TABLE: '%s'", matches[0][1], strings.TrimSpace(line))
+		}
+
+		var err error
+		for _, match := range matches {
+			switch match[1] {
+			case "algorithm":
+				table.algorithms, err = ParseAlgorithms(match[2])
+			case "lock":
+				table.lock, err = ParseLock(match[2])
+			}
+			if err != nil {
+				return fmt.Errorf("invalid annotation of table '%s': %w", table.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Append ALGORITHM= and LOCK= given by GeneratorOptions or the table's annotations to MySQL's ALTER TABLE.
+// ALTER TABLE with the algorithms after the first one are set to Change.Fallbacks.
+func (g *Generator) withAlterOptions(table Table, changes []Change) []Change {
+	if g.mode != GeneratorModeMysql {
+		return changes
+	}
+	algorithms, lock := g.options.Algorithms, g.options.Lock
+	if len(table.algorithms) > 0 {
+		algorithms = table.algorithms
+	}
+	if table.lock != "" {
+		lock = table.lock
+	}
+	if len(algorithms) == 0 && lock == "" {
+		return changes
+	}
+
+	for i, change := range changes {
+		if !strings.HasPrefix(change.SQL, "ALTER TABLE ") {
+			continue
+		}
+		var ddls []string
+		if len(algorithms) == 0 {
+			ddls = append(ddls, fmt.Sprintf("%s, LOCK=%s", change.SQL, lock))
+		}
+		for _, algorithm := range algorithms {
+			ddl := fmt.Sprintf("%s, ALGORITHM=%s", change.SQL, algorithm)
+			if lock != "" {
+				ddl += fmt.Sprintf(", LOCK=%s", lock)
+			}
+			ddls = append(ddls, ddl)
+		}
+		changes[i].SQL = ddls[0]
+		if len(ddls) > 1 {
+			changes[i].Fallbacks = ddls[1:]
+		}
+	}
+	return changes
+}
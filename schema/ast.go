@@ -47,6 +47,9 @@ type Table struct {
 	checks      []CheckDefinition
 	foreignKeys []ForeignKey
 	policies    []Policy
+	renamedFrom string   // given by `-- @renamed from old_name`
+	algorithms  []string // given by `-- @algorithm=INSTANT,INPLACE` for MySQL
+	lock        string   // given by `-- @lock=NONE` for MySQL
 	// XXX: have options and alter on its change?
 }
 
@@ -72,6 +75,9 @@ type Column struct {
 	references    string
 	identity      *Identity
 	sequence      *Sequence
+	renamedFrom   string // given by `-- @renamed from old_name`, or --detect-renames
+	// True if renamedFrom is given by --detect-renames
+	renameDetected bool
 	// TODO: keyopt
 	// XXX: zerofill?
 }
@@ -89,6 +95,7 @@ type Index struct {
 	clustered         bool           // for MSSQL
 	partition         IndexPartition // for MSSQL
 	options           []IndexOption
+	renamedFrom       string // given by --detect-renames
 }
 
 type IndexColumn struct {
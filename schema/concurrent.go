@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"regexp"
+)
+
+var (
+	// `CREATE INDEX CONCURRENTLY` of Postgres, which is parsed as the plain form
+	concurrentIndex = regexp.MustCompile(`(?i)^((?:\s*--[^\n]*\n)*\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+)CONCURRENTLY\s+`)
+	// `CREATE INDEX` and `DROP INDEX` to which CONCURRENTLY is inserted
+	plainIndex = regexp.MustCompile(`(?i)^(\s*(?:CREATE\s+(?:UNIQUE\s+)?|DROP\s+)INDEX\s+)`)
+)
+
+// Remove CONCURRENTLY of `CREATE INDEX CONCURRENTLY`, which doesn't change the index.
+// It's added back by GeneratorOptions.ConcurrentIndexes.
+func removeConcurrently(ddl string) string {
+	return concurrentIndex.ReplaceAllString(ddl, "$1")
+}
+
+// Make Postgres' CREATE INDEX and DROP INDEX CONCURRENTLY if GeneratorOptions.ConcurrentIndexes is set.
+// They don't block writes to the table, but can't run in a transaction.
+func (g *Generator) withConcurrentIndexes(changes []Change) []Change {
+	if g.mode != GeneratorModePostgres || !g.options.ConcurrentIndexes {
+		return changes
+	}
+	for i, change := range changes {
+		if change.ObjectType != ObjectTypeIndex || !plainIndex.MatchString(change.SQL) {
+			continue
+		}
+		changes[i].SQL = plainIndex.ReplaceAllString(change.SQL, "${1}CONCURRENTLY ")
+		changes[i].NoTransaction = true
+	}
+	return changes
+}
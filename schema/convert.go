@@ -0,0 +1,568 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+var generatorModeNames = []string{"mysql", "postgres", "sqlite3", "mssql"}
+
+// Parse a dialect name given to --convert-to
+func ParseGeneratorMode(name string) (GeneratorMode, error) {
+	for i, modeName := range generatorModeNames {
+		if name == modeName {
+			return GeneratorMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dialect '%s' (expected one of: %s)", name, strings.Join(generatorModeNames, ", "))
+}
+
+// Data types renamed by ConvertDDLs, keyed by the dialect converted to. Types which are not listed are kept as is.
+// A type with parentheses replaces the length of the column too.
+var convertedDataTypes = map[GeneratorMode]map[string]string{
+	GeneratorModeMysql: {
+		"integer":           "int",
+		"int2":              "smallint",
+		"int4":              "int",
+		"int8":              "bigint",
+		"character varying": "varchar",
+		"character":         "char",
+		"nvarchar":          "varchar",
+		"nchar":             "char",
+		"ntext":             "longtext",
+		"boolean":           "tinyint(1)",
+		"bool":              "tinyint(1)",
+		"bytea":             "longblob",
+		"image":             "longblob",
+		"real":              "float",
+		"float4":            "float",
+		"float8":            "double",
+		"double precision":  "double",
+		"timestamp":         "datetime",
+		"datetime2":         "datetime",
+		"smalldatetime":     "datetime",
+		"datetimeoffset":    "timestamp",
+		"uuid":              "char(36)",
+		"uniqueidentifier":  "char(36)",
+		"jsonb":             "json",
+	},
+	GeneratorModePostgres: {
+		"tinyint":          "smallint",
+		"mediumint":        "integer",
+		"int":              "integer",
+		"nvarchar":         "varchar",
+		"nchar":            "char",
+		"tinytext":         "text",
+		"mediumtext":       "text",
+		"longtext":         "text",
+		"ntext":            "text",
+		"tinyblob":         "bytea",
+		"blob":             "bytea",
+		"mediumblob":       "bytea",
+		"longblob":         "bytea",
+		"binary":           "bytea",
+		"varbinary":        "bytea",
+		"image":            "bytea",
+		"double":           "double precision",
+		"float":            "real",
+		"datetime":         "timestamp",
+		"datetime2":        "timestamp",
+		"smalldatetime":    "timestamp",
+		"year":             "smallint",
+		"uniqueidentifier": "uuid",
+	},
+	GeneratorModeSQLite3: {
+		"character varying": "varchar",
+		"character":         "char",
+		"nvarchar":          "varchar",
+		"nchar":             "char",
+		"ntext":             "text",
+		"bytea":             "blob",
+		"image":             "blob",
+		"datetime2":         "datetime",
+		"datetimeoffset":    "datetime",
+		"uniqueidentifier":  "text",
+		"uuid":              "text",
+		"jsonb":             "json",
+	},
+	GeneratorModeMssql: {
+		"integer":           "int",
+		"int2":              "smallint",
+		"int4":              "int",
+		"int8":              "bigint",
+		"mediumint":         "int",
+		"character varying": "varchar",
+		"character":         "char",
+		"text":              "varchar(max)",
+		"tinytext":          "varchar(255)",
+		"mediumtext":        "varchar(max)",
+		"longtext":          "varchar(max)",
+		"boolean":           "bit",
+		"bool":              "bit",
+		"bytea":             "varbinary(max)",
+		"tinyblob":          "varbinary(255)",
+		"blob":              "varbinary(max)",
+		"mediumblob":        "varbinary(max)",
+		"longblob":          "varbinary(max)",
+		"double precision":  "float",
+		"double":            "float",
+		"float8":            "float",
+		"float4":            "real",
+		"timestamp":         "datetime2",
+		"datetime":          "datetime2",
+		"uuid":              "uniqueidentifier",
+		"json":              "nvarchar(max)",
+		"jsonb":             "nvarchar(max)",
+		"year":              "smallint",
+	},
+}
+
+// Types of Postgres' serial columns, which are converted to auto-increment columns
+var serialDataTypes = map[string]string{
+	"smallserial": "smallint",
+	"serial":      "integer",
+	"bigserial":   "bigint",
+}
+
+type converter struct {
+	from      GeneratorMode
+	to        GeneratorMode
+	generator *Generator // Escapes names and generates definitions in the dialect converted to
+	unmapped  []string
+}
+
+// Convert `sql` written for the dialect of `from` to DDLs for the dialect of `to`. Tables, indexes and foreign keys are
+// converted through the data type mapping, while constructs which can't be converted are dropped and described in
+// the second return value. Views are copied as is.
+func ConvertDDLs(from GeneratorMode, to GeneratorMode, sql string) ([]string, []string, error) {
+	ddls, err := ParseDDLs(from, "public", sql)
+	if err != nil {
+		return nil, nil, err
+	}
+	tables, err := convertDDLsToTables(ddls)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &converter{
+		from:      from,
+		to:        to,
+		generator: &Generator{mode: to, options: GeneratorOptions{DefaultSchema: "public"}},
+	}
+	var results, foreignKeys []string
+	for _, table := range tables {
+		tableDDLs, tableForeignKeys, err := c.convertTable(*table)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, tableDDLs...)
+		foreignKeys = append(foreignKeys, tableForeignKeys...)
+	}
+	// Foreign keys are added after all tables are created, since they may reference tables created later
+	results = append(results, foreignKeys...)
+
+	for _, ddl := range ddls {
+		switch ddl := ddl.(type) {
+		case *View:
+			viewName := c.convertName(ddl.name)
+			c.report("the definition of view '%s' is copied without conversion", viewName)
+			results = append(results, fmt.Sprintf("CREATE VIEW %s AS %s", c.generator.escapeTableName(viewName), ddl.definition))
+		case *Trigger:
+			c.report("trigger '%s' is not converted", ddl.name)
+		case *Type:
+			c.report("type '%s' is not converted", ddl.name)
+		}
+	}
+	return results, c.unmapped, nil
+}
+
+func (c *converter) report(format string, args ...interface{}) {
+	c.unmapped = append(c.unmapped, fmt.Sprintf(format, args...))
+}
+
+// Return the DDLs to create the table and its indexes, and DDLs to add its foreign keys
+func (c *converter) convertTable(table Table) ([]string, []string, error) {
+	g := c.generator
+	tableName := c.convertName(table.name)
+
+	var primaryKey *Index
+	for i, index := range table.indexes {
+		if index.primary {
+			primaryKey = &table.indexes[i]
+		}
+	}
+	if primaryKey == nil {
+		for _, column := range table.columns {
+			if column.keyOption == ColumnKeyPrimary {
+				if primaryKey == nil {
+					primaryKey = &Index{name: "PRIMARY", primary: true}
+				}
+				primaryKey.columns = append(primaryKey.columns, IndexColumn{column: column.name})
+			}
+		}
+	}
+
+	var definitions, comments []string
+	inlinePrimaryKey := false
+	hasAutoIncrement := false
+	for _, column := range table.columns {
+		column := c.convertColumn(tableName, column)
+		if column.autoIncrement || column.identity != nil {
+			if hasAutoIncrement && c.to != GeneratorModePostgres {
+				c.report("auto increment of column '%s.%s' is dropped, which is allowed only once in a table", tableName, column.name)
+				column.autoIncrement, column.identity, column.sequence = false, nil, nil
+			}
+			hasAutoIncrement = true
+		}
+		comment := column.comment
+		if c.to != GeneratorModeMysql {
+			column.comment = nil // COMMENT is MySQL's syntax
+		}
+		// SQLite3's AUTOINCREMENT is allowed only for INTEGER PRIMARY KEY
+		autoIncrement := c.to == GeneratorModeSQLite3 && column.autoIncrement
+		if autoIncrement {
+			column.autoIncrement = false
+			if primaryKey != nil && len(primaryKey.columns) == 1 && primaryKey.columns[0].column == column.name {
+				column.typeName, column.length = "integer", nil
+			} else {
+				c.report("auto increment of column '%s.%s' is dropped, which is allowed only for the primary key", tableName, column.name)
+				autoIncrement = false
+			}
+		}
+		definition, err := g.generateColumnDefinition(column, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if autoIncrement {
+			definition += " PRIMARY KEY AUTOINCREMENT"
+			inlinePrimaryKey = true
+		}
+		definitions = append(definitions, definition)
+
+		if comment != nil {
+			if c.to == GeneratorModePostgres {
+				comments = append(comments, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS '%s'", g.escapeTableName(tableName), g.escapeSQLName(column.name),
+					strings.ReplaceAll(string(comment.raw), "'", "''")))
+			} else if c.to != GeneratorModeMysql {
+				c.report("comment of column '%s.%s' is not converted", tableName, column.name)
+			}
+		}
+	}
+
+	if primaryKey != nil && !inlinePrimaryKey {
+		definition := fmt.Sprintf("PRIMARY KEY (%s)", c.indexColumns(tableName, *primaryKey))
+		if primaryKey.name != "" && primaryKey.name != "PRIMARY" && c.to != GeneratorModeMysql {
+			definition = fmt.Sprintf("CONSTRAINT %s %s", g.escapeSQLName(primaryKey.name), definition)
+		}
+		definitions = append(definitions, definition)
+	}
+	for _, check := range table.checks {
+		definition := fmt.Sprintf("CHECK (%s)", check.definition)
+		if check.constraintName != "" {
+			definition = fmt.Sprintf("CONSTRAINT %s %s", g.escapeSQLName(check.constraintName), definition)
+		}
+		definitions = append(definitions, definition)
+	}
+
+	var foreignKeys []string
+	for _, foreignKey := range table.foreignKeys {
+		definition := g.generateForeignKeyDefinition(c.convertForeignKey(tableName, foreignKey))
+		if c.to == GeneratorModeSQLite3 { // SQLite3 can't add foreign keys to existing tables
+			definitions = append(definitions, definition)
+		} else {
+			foreignKeys = append(foreignKeys, fmt.Sprintf("ALTER TABLE %s ADD %s", g.escapeTableName(tableName), definition))
+		}
+	}
+	for _, policy := range table.policies {
+		c.report("policy '%s' of table '%s' is not converted", policy.name, tableName)
+	}
+
+	ddls := []string{fmt.Sprintf("CREATE TABLE %s (\n%s%s\n)", g.escapeTableName(tableName), indent, strings.Join(definitions, ",\n"+indent))}
+	for _, index := range table.indexes {
+		if index.primary {
+			continue
+		}
+		if ddl, ok := c.convertIndex(tableName, index); ok {
+			ddls = append(ddls, ddl)
+		}
+	}
+	ddls = append(ddls, comments...)
+	return ddls, foreignKeys, nil
+}
+
+const indent = "    "
+
+// Strip the default schema of the dialect converted from, and a schema the dialect converted to doesn't have
+func (c *converter) convertName(name string) string {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) == 1 {
+		return name
+	}
+	if (c.from == GeneratorModePostgres && parts[0] == "public") || (c.from == GeneratorModeMssql && parts[0] == "dbo") {
+		return parts[1]
+	}
+	if c.to == GeneratorModeMysql || c.to == GeneratorModeSQLite3 {
+		c.report("schema of '%s' is dropped", name)
+		return parts[1]
+	}
+	return name
+}
+
+func (c *converter) convertColumn(tableName string, column Column) Column {
+	columnName := tableName + "." + column.name
+
+	// Auto increment is expressed by AUTO_INCREMENT, serial types, or IDENTITY
+	autoIncrement := column.autoIncrement || column.identity != nil
+	if typeName, ok := serialDataTypes[column.typeName]; ok {
+		column.typeName = typeName
+		autoIncrement = true
+	}
+	column.autoIncrement, column.identity, column.sequence = false, nil, nil
+	if autoIncrement {
+		switch c.to {
+		case GeneratorModeMysql, GeneratorModeSQLite3:
+			column.autoIncrement = true
+		case GeneratorModePostgres:
+			column.identity = &Identity{behavior: "BY DEFAULT"}
+		case GeneratorModeMssql:
+			one := 1
+			column.identity = &Identity{}
+			column.sequence = &Sequence{StartWith: &one, IncrementBy: &one}
+		}
+	}
+
+	if column.array && c.to != GeneratorModePostgres {
+		c.report("array column '%s' is converted to text", columnName)
+		column.typeName, column.length, column.scale, column.array = "text", nil, nil, false
+	}
+
+	switch {
+	case c.from == GeneratorModeMysql && column.typeName == "tinyint" && column.length != nil && string(column.length.raw) == "1":
+		column.typeName, column.length = "boolean", nil // MySQL's boolean
+		if c.to == GeneratorModeMssql {
+			column.typeName = "bit"
+		}
+	case c.from == GeneratorModeMssql && column.typeName == "bit":
+		column.typeName = "boolean"
+		if c.to == GeneratorModeMysql {
+			column.typeName = "tinyint(1)"
+		}
+	case column.typeName == "enum" && c.to != GeneratorModeMysql:
+		// Keep the values by a check constraint
+		size := 1
+		for _, value := range column.enumValues {
+			if len(value)-2 > size {
+				size = len(value) - 2
+			}
+		}
+		if column.check != nil {
+			c.report("check constraint of column '%s' is replaced with its enum values", columnName)
+		}
+		column.check = &CheckDefinition{definition: fmt.Sprintf("%s IN (%s)", c.generator.escapeSQLName(column.name), strings.Join(column.enumValues, ", "))}
+		column.typeName, column.enumValues = fmt.Sprintf("varchar(%d)", size), nil
+	case (column.timezone || column.typeName == "timestamptz") && c.to != GeneratorModePostgres:
+		column.typeName = map[GeneratorMode]string{GeneratorModeMysql: "timestamp", GeneratorModeSQLite3: "datetime", GeneratorModeMssql: "datetimeoffset"}[c.to]
+		if c.to != GeneratorModeMssql {
+			c.report("time zone of column '%s' is dropped", columnName)
+		}
+	case column.typeName == "datetimeoffset" && c.to == GeneratorModePostgres:
+		column.typeName, column.timezone = "timestamp", true
+	case (column.typeName == "character varying" || column.typeName == "varchar") && column.length == nil:
+		// Postgres' varchar without a length is unlimited, while it's invalid in MySQL and varchar(1) in SQL Server
+		switch c.to {
+		case GeneratorModeMysql:
+			column.typeName = "text"
+		case GeneratorModeMssql:
+			column.typeName = "varchar(max)"
+		}
+	}
+	if c.to != GeneratorModePostgres {
+		column.timezone = false
+	}
+	if typeName, ok := convertedDataTypes[c.to][column.typeName]; ok {
+		column.typeName = typeName
+	}
+	if strings.Contains(column.typeName, "(") {
+		column.length, column.scale = nil, nil
+	}
+	if column.typeName == "bytea" || column.typeName == "blob" {
+		column.length = nil
+	}
+
+	if column.unsigned && c.to != GeneratorModeMysql {
+		c.report("UNSIGNED of column '%s' is dropped", columnName)
+		column.unsigned = false
+	}
+	if (column.charset != "" || column.collate != "") && c.to != GeneratorModeMysql {
+		c.report("character set and collation of column '%s' are dropped", columnName)
+		column.charset, column.collate = "", ""
+	}
+	if column.onUpdate != nil && c.to != GeneratorModeMysql {
+		c.report("ON UPDATE of column '%s' is dropped", columnName)
+		column.onUpdate = nil
+	}
+	if column.keyOption == ColumnKeyUniqueKey && c.to != GeneratorModeMysql {
+		column.keyOption = ColumnKeyUnique
+	}
+	if column.references != "" && !strings.HasSuffix(column.references, ".") { // "public." if not given
+		c.report("REFERENCES of column '%s' is dropped, which must be written as a FOREIGN KEY", columnName)
+	}
+	column.references = ""
+
+	if column.defaultDef != nil && column.defaultDef.value != nil {
+		if value, ok := c.convertFunctionDefault(column.defaultDef.value); !ok {
+			c.report("default of column '%s' is dropped", columnName)
+			column.defaultDef = nil
+		} else {
+			column.defaultDef = &DefaultDefinition{value: convertBooleanDefault(column.typeName, value)}
+		}
+	}
+	return column
+}
+
+// Convert a default value given by a function, e.g. CURRENT_TIMESTAMP, now() and getdate(), to the function of the
+// dialect converted to. The second return value is false if the function has no counterpart there.
+func (c *converter) convertFunctionDefault(value *Value) (*Value, bool) {
+	var name, precision string
+	switch {
+	case value.valueType == ValueTypeValArg: // NULL, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP(6), getdate, ...
+		name = strings.ToUpper(string(value.raw))
+		if i := strings.Index(name, "("); i >= 0 {
+			name, precision = name[:i], name[i:]
+		}
+	case value.valueType == ValueTypeBit && strings.EqualFold(string(value.raw), "now"): // now() is parsed as a bit
+		name = "NOW"
+	default:
+		return value, true
+	}
+
+	switch name {
+	case "NULL":
+		return value, true
+	case "CURRENT_TIMESTAMP", "NOW", "GETDATE":
+		name = "CURRENT_TIMESTAMP"
+		if c.to == GeneratorModeMssql || c.to == GeneratorModeSQLite3 {
+			precision = ""
+		}
+	case "CURRENT_DATE", "CURRENT_TIME":
+		// MySQL accepts only CURRENT_TIMESTAMP without parentheses, and SQL Server has neither of them
+		if c.to == GeneratorModeMysql || c.to == GeneratorModeMssql {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	return &Value{valueType: ValueTypeValArg, raw: []byte(name + precision)}, true
+}
+
+// Convert a default value of a boolean column between true/false and 1/0
+func convertBooleanDefault(typeName string, value *Value) *Value {
+	switch typeName {
+	case "boolean":
+		if value.valueType == ValueTypeInt {
+			return &Value{valueType: ValueTypeBool, strVal: fmt.Sprint(value.intVal != 0), raw: []byte(fmt.Sprint(value.intVal != 0))}
+		}
+	case "bit", "tinyint(1)":
+		if value.valueType == ValueTypeBool {
+			intVal := 0
+			if strings.ToLower(value.strVal) == "true" {
+				intVal = 1
+			}
+			return &Value{valueType: ValueTypeInt, intVal: intVal, raw: []byte(fmt.Sprint(intVal))}
+		}
+	}
+	return value
+}
+
+func (c *converter) convertIndex(tableName string, index Index) (string, bool) {
+	g := c.generator
+	indexType := strings.ToLower(index.indexType)
+	if strings.Contains(indexType, "fulltext") || strings.Contains(indexType, "spatial") {
+		if c.to != c.from {
+			c.report("%s index '%s' of table '%s' is not converted", strings.Fields(indexType)[0], index.name, tableName)
+			return "", false
+		}
+	}
+	if index.where != "" && c.to == GeneratorModeMysql {
+		c.report("partial index '%s' of table '%s' is not converted", index.name, tableName)
+		return "", false
+	}
+	if len(index.columns) == 0 { // the expression of an expression index is not parsed
+		c.report("expression index '%s' of table '%s' is not converted", index.name, tableName)
+		return "", false
+	}
+	if len(index.options) > 0 {
+		c.report("options of index '%s' of table '%s' are dropped", index.name, tableName)
+	}
+
+	name := index.name
+	if name == "" {
+		columns := make([]string, len(index.columns))
+		for i, column := range index.columns {
+			columns[i] = column.column
+		}
+		name = fmt.Sprintf("%s_%s_idx", strings.ReplaceAll(tableName, ".", "_"), strings.Join(columns, "_"))
+	}
+
+	ddl := "CREATE"
+	if index.unique {
+		ddl += " UNIQUE"
+	}
+	ddl += fmt.Sprintf(" INDEX %s ON %s (%s)", g.escapeSQLName(name), g.escapeTableName(tableName), c.indexColumns(tableName, index))
+	if len(index.included) > 0 {
+		if c.to == GeneratorModePostgres || c.to == GeneratorModeMssql {
+			included := make([]string, len(index.included))
+			for i, column := range index.included {
+				included[i] = g.escapeSQLName(column)
+			}
+			ddl += fmt.Sprintf(" INCLUDE (%s)", strings.Join(included, ", "))
+		} else {
+			c.report("INCLUDE of index '%s' of table '%s' is dropped", index.name, tableName)
+		}
+	}
+	if index.where != "" {
+		ddl += " WHERE " + index.where
+	}
+	return ddl, true
+}
+
+func (c *converter) indexColumns(tableName string, index Index) string {
+	columns := make([]string, len(index.columns))
+	for i, indexColumn := range index.columns {
+		column := c.generator.escapeSQLName(indexColumn.column)
+		if indexColumn.length != nil {
+			if c.to == GeneratorModeMysql {
+				column += fmt.Sprintf("(%d)", *indexColumn.length)
+			} else {
+				c.report("prefix length of column '%s' in index '%s' of table '%s' is dropped", indexColumn.column, index.name, tableName)
+			}
+		}
+		if indexColumn.direction == DescScr {
+			column += " DESC"
+		}
+		columns[i] = column
+	}
+	return strings.Join(columns, ", ")
+}
+
+func (c *converter) convertForeignKey(tableName string, foreignKey ForeignKey) ForeignKey {
+	if foreignKey.constraintName == "" {
+		foreignKey.constraintName = fmt.Sprintf("%s_%s_fkey", strings.ReplaceAll(tableName, ".", "_"), strings.Join(foreignKey.indexColumns, "_"))
+	}
+	foreignKey.referenceName = c.convertName(foreignKey.referenceName)
+	if c.to != GeneratorModeMysql {
+		foreignKey.indexName = ""
+	}
+	if c.to != GeneratorModeMssql {
+		foreignKey.notForReplication = false
+	} else {
+		// SQL Server doesn't have RESTRICT, which is the same as NO ACTION in effect
+		if strings.ToUpper(foreignKey.onDelete) == "RESTRICT" {
+			foreignKey.onDelete = "NO ACTION"
+		}
+		if strings.ToUpper(foreignKey.onUpdate) == "RESTRICT" {
+			foreignKey.onUpdate = "NO ACTION"
+		}
+	}
+	return foreignKey
+}
@@ -30,11 +30,52 @@ var (
 	mysqlDataTypeAliases = map[string]string{
 		"boolean": "tinyint",
 	}
+	// Storage size of integer types, used to find narrowing type changes
+	integerTypeSizes = map[string]int{
+		"tinyint":   1,
+		"smallint":  2,
+		"int2":      2,
+		"mediumint": 3,
+		"integer":   4,
+		"int4":      4,
+		"bigint":    8,
+		"int8":      8,
+	}
+	floatTypeSizes = map[string]int{
+		"real":             4,
+		"float4":           4,
+		"float8":           8,
+		"double":           8,
+		"double precision": 8,
+	}
 )
 
+// Optional behaviors of GenerateIdempotentPlan
+type GeneratorOptions struct {
+	// Rename columns and indexes that have the same definition instead of dropping and adding them
+	DetectRenames bool
+	// Files concatenated into desiredSQL, to show where doubly created objects are defined
+	DesiredFiles []SourceFile
+	// Manage only tables, views and types whose names are accepted by this, and treat the others as nonexistent
+	// in both desiredSQL and currentSQL. Indexes, constraints, policies and triggers follow their tables.
+	// Everything is managed if nil.
+	Filter func(name string) bool
+	// Postgres schema of unqualified names in desiredSQL. "public" if empty.
+	DefaultSchema string
+	// Postgres schemas to manage. Objects in the other schemas are treated as nonexistent. Every schema is managed if empty.
+	Schemas []string
+	// MySQL's ALGORITHM= values tried in order and LOCK= of ALTER TABLE for existing tables, which are
+	// overridden by `-- @algorithm=` and `-- @lock=` of the table. They're not appended if empty.
+	Algorithms []string
+	Lock       string
+	// Run Postgres' CREATE INDEX and DROP INDEX CONCURRENTLY outside the transaction not to block writes
+	ConcurrentIndexes bool
+}
+
 // This struct holds simulated schema states during GenerateIdempotentDDLs().
 type Generator struct {
 	mode          GeneratorMode
+	options       GeneratorOptions
 	desiredTables []*Table
 	currentTables []*Table
 
@@ -46,21 +87,48 @@ type Generator struct {
 
 	desiredTypes []*Type
 	currentTypes []*Type
+
+	desiredSQL       string
+	desiredOffset    int // Position of the desired DDL being examined
+	desiredLocations map[objectKey]int
 }
 
 // Parse argument DDLs and call `generateDDLs()`
 func GenerateIdempotentDDLs(mode GeneratorMode, desiredSQL string, currentSQL string) ([]string, error) {
-	// TODO: invalidate duplicated tables, columns
-	desiredDDLs, err := ParseDDLs(mode, desiredSQL)
+	plan, err := GenerateIdempotentPlan(mode, desiredSQL, currentSQL, GeneratorOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return plan.DDLs(), nil
+}
+
+// Same as GenerateIdempotentDDLs, but each DDL comes with what it changes.
+func GenerateIdempotentPlan(mode GeneratorMode, desiredSQL string, currentSQL string, options GeneratorOptions) (Plan, error) {
+	// TODO: invalidate duplicated columns
+	if options.DefaultSchema == "" {
+		options.DefaultSchema = "public"
+	}
+
+	desiredDDLs, desiredOffsets, err := parseDDLsWithOffsets(mode, options.DefaultSchema, desiredSQL)
 	if err != nil {
 		return nil, err
 	}
 
-	currentDDLs, err := ParseDDLs(mode, currentSQL)
+	// Dumped names are qualified unless they're in "public"
+	currentDDLs, err := ParseDDLs(mode, "public", currentSQL)
 	if err != nil {
 		return nil, err
 	}
 
+	if options.Filter != nil {
+		desiredDDLs, desiredOffsets = filterDDLs(desiredDDLs, desiredOffsets, options.Filter)
+		currentDDLs, _ = filterDDLs(currentDDLs, make([]int, len(currentDDLs)), options.Filter)
+	}
+	if mode == GeneratorModePostgres && len(options.Schemas) > 0 {
+		desiredDDLs, desiredOffsets = filterDDLsBySchemas(desiredDDLs, desiredOffsets, options.Schemas, options.DefaultSchema)
+		currentDDLs, _ = filterDDLsBySchemas(currentDDLs, make([]int, len(currentDDLs)), options.Schemas, "public")
+	}
+
 	tables, err := convertDDLsToTables(currentDDLs)
 	if err != nil {
 		return nil, err
@@ -72,6 +140,7 @@ func GenerateIdempotentDDLs(mode GeneratorMode, desiredSQL string, currentSQL st
 
 	generator := Generator{
 		mode:            mode,
+		options:         options,
 		desiredTables:   []*Table{},
 		currentTables:   tables,
 		desiredViews:    []*View{},
@@ -80,29 +149,72 @@ func GenerateIdempotentDDLs(mode GeneratorMode, desiredSQL string, currentSQL st
 		currentTriggers: triggers,
 		desiredTypes:    []*Type{},
 		currentTypes:    types,
+
+		desiredSQL:       desiredSQL,
+		desiredLocations: map[objectKey]int{},
+	}
+	ddls, err := generator.generateDDLs(desiredDDLs, desiredOffsets)
+	if err != nil {
+		return nil, err
 	}
-	return generator.generateDDLs(desiredDDLs)
+	return Plan(ddls), nil
 }
 
 // Main part of DDL genearation
-func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
-	ddls := []string{}
+func (g *Generator) generateDDLs(desiredDDLs []DDL, desiredOffsets []int) ([]Change, error) {
+	ddls := []Change{}
+
+	if g.options.DetectRenames {
+		g.detectRenamedIndexes(desiredDDLs)
+	}
 
 	// Incrementally examine desiredDDLs
-	for _, ddl := range desiredDDLs {
+	for i, ddl := range desiredDDLs {
+		g.desiredOffset = desiredOffsets[i]
 		switch desired := ddl.(type) {
 		case *CreateTable:
-			if currentTable := findTableByName(g.currentTables, desired.table.name); currentTable != nil {
+			tableKey := objectKey{objectType: ObjectTypeTable, table: desired.table.name}
+			if findTableByName(g.desiredTables, desired.table.name) != nil {
+				return ddls, fmt.Errorf("table '%s' is doubly created (%s): '%s'", desired.table.name, g.doublyCreatedAt(tableKey), desired.statement)
+			}
+			g.defineDesired(tableKey)
+			for _, index := range desired.table.indexes {
+				g.defineDesired(objectKey{objectType: ObjectTypeIndex, table: desired.table.name, name: index.name})
+			}
+			for _, foreignKey := range desired.table.foreignKeys {
+				g.defineDesired(objectKey{objectType: ObjectTypeForeignKey, table: desired.table.name, name: foreignKey.constraintName})
+			}
+
+			currentTable := findTableByName(g.currentTables, desired.table.name)
+			if currentTable == nil && desired.table.renamedFrom != "" {
+				renameDDLs, err := g.generateDDLsForRenamedTable(desired.table)
+				if err != nil {
+					return ddls, err
+				}
+				ddls = append(ddls, renameDDLs...)
+				currentTable = findTableByName(g.currentTables, desired.table.name)
+			}
+
+			if currentTable != nil {
 				// Table already exists, guess required DDLs.
+				if g.options.DetectRenames {
+					g.detectRenamedColumns(*currentTable, &desired.table)
+				}
+				renameDDLs, err := g.generateDDLsForRenamedColumns(currentTable, desired.table)
+				if err != nil {
+					return ddls, err
+				}
+				ddls = append(ddls, g.withAlterOptions(desired.table, renameDDLs)...)
+
 				tableDDLs, err := g.generateDDLsForCreateTable(*currentTable, *desired)
 				if err != nil {
 					return ddls, err
 				}
-				ddls = append(ddls, tableDDLs...)
+				ddls = append(ddls, g.withAlterOptions(desired.table, tableDDLs)...)
 				mergeTable(currentTable, desired.table)
 			} else {
 				// Table not found, create table.
-				ddls = append(ddls, desired.statement)
+				ddls = append(ddls, createChange(ObjectTypeTable, desired.table.name, desired.statement))
 				table := desired.table // copy table
 				g.currentTables = append(g.currentTables, &table)
 			}
@@ -113,7 +225,7 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 			if err != nil {
 				return ddls, err
 			}
-			ddls = append(ddls, indexDDLs...)
+			ddls = append(ddls, g.withConcurrentIndexes(indexDDLs)...)
 		case *AddIndex:
 			indexDDLs, err := g.generateDDLsForCreateIndex(desired.tableName, desired.index, "ALTER TABLE", ddl.Statement())
 			if err != nil {
@@ -160,7 +272,7 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 		desiredTable := findTableByName(g.desiredTables, currentTable.name)
 		if desiredTable == nil {
 			// Obsoleted table found. Drop table.
-			ddls = append(ddls, fmt.Sprintf("DROP TABLE %s", g.escapeTableName(currentTable.name)))
+			ddls = append(ddls, dropChange(ObjectTypeTable, currentTable.name, fmt.Sprintf("DROP TABLE %s", g.escapeTableName(currentTable.name))))
 			g.currentTables = removeTableByName(g.currentTables, currentTable.name)
 			continue
 		}
@@ -173,7 +285,7 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 
 			// The foreign key seems obsoleted. Check and drop it as needed.
 			foreignKeyDDLs := g.generateDDLsForAbsentForeignKey(foreignKey, *currentTable, *desiredTable)
-			ddls = append(ddls, foreignKeyDDLs...)
+			ddls = append(ddls, g.withAlterOptions(*desiredTable, foreignKeyDDLs)...)
 			// TODO: simulate to remove foreign key from `currentTable.foreignKeys`?
 		}
 
@@ -189,7 +301,7 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 			if err != nil {
 				return ddls, err
 			}
-			ddls = append(ddls, indexDDLs...)
+			ddls = append(ddls, g.withConcurrentIndexes(g.withAlterOptions(*desiredTable, indexDDLs))...)
 			// TODO: simulate to remove index from `currentTable.indexes`?
 		}
 
@@ -201,7 +313,7 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 
 			// Column is obsoleted. Drop column.
 			columnDDLs := g.generateDDLsForAbsentColumn(currentTable, column.name)
-			ddls = append(ddls, columnDDLs...)
+			ddls = append(ddls, g.withAlterOptions(*desiredTable, columnDDLs)...)
 			// TODO: simulate to remove column from `currentTable.columns`?
 		}
 
@@ -210,7 +322,8 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 			if containsString(convertPolicyNames(desiredTable.policies), policy.name) {
 				continue
 			}
-			ddls = append(ddls, fmt.Sprintf("DROP POLICY %s ON %s", g.escapeSQLName(policy.name), g.escapeTableName(currentTable.name)))
+			ddl := fmt.Sprintf("DROP POLICY %s ON %s", g.escapeSQLName(policy.name), g.escapeTableName(currentTable.name))
+			ddls = append(ddls, dropChange(ObjectTypePolicy, currentTable.name, ddl).withName(policy.name))
 		}
 
 		// Check checks.
@@ -219,7 +332,8 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 				continue
 			}
 			if g.mode != GeneratorModeMysql { // workaround. inline CHECK should be converted to out-of-place CONSTRAINT to fix this.
-				ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(check.constraintName)))
+				ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(check.constraintName))
+				ddls = append(ddls, dropChange(ObjectTypeCheck, currentTable.name, ddl).withName(check.constraintName))
 			}
 		}
 	}
@@ -229,32 +343,33 @@ func (g *Generator) generateDDLs(desiredDDLs []DDL) ([]string, error) {
 		if containsString(convertViewNames(g.desiredViews), currentView.name) {
 			continue
 		}
-		ddls = append(ddls, fmt.Sprintf("DROP VIEW %s", g.escapeTableName(currentView.name)))
+		ddls = append(ddls, dropChange(ObjectTypeView, currentView.name, fmt.Sprintf("DROP VIEW %s", g.escapeTableName(currentView.name))))
 	}
 
 	return ddls, nil
 }
 
-func (g *Generator) generateDDLsForAbsentColumn(currentTable *Table, columnName string) []string {
-	ddls := []string{}
+func (g *Generator) generateDDLsForAbsentColumn(currentTable *Table, columnName string) []Change {
+	ddls := []Change{}
 
 	// Only MSSQL has column default constraints. They need to be deleted before dropping the column.
 	if g.mode == GeneratorModeMssql {
 		for _, column := range currentTable.columns {
 			if column.name == columnName && column.defaultDef != nil && column.defaultDef.constraintName != "" {
 				ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(column.defaultDef.constraintName))
-				ddls = append(ddls, ddl)
+				ddls = append(ddls, alterChange(ObjectTypeColumn, currentTable.name, ddl).withColumn(columnName).withName(column.defaultDef.constraintName))
 			}
 		}
 	}
 
 	ddl := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", g.escapeTableName(currentTable.name), g.escapeSQLName(columnName))
-	return append(ddls, ddl)
+	return append(ddls, dropChange(ObjectTypeColumn, currentTable.name, ddl).withColumn(columnName))
 }
 
 // In the caller, `mergeTable` manages `g.currentTables`.
-func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired CreateTable) ([]string, error) {
-	ddls := []string{}
+func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired CreateTable) ([]Change, error) {
+	ddls := []Change{}
+	tableName := desired.table.name
 
 	// Examine each column
 	for i, desiredColumn := range desired.table.columns {
@@ -286,7 +401,7 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				ddl += after
 			}
 
-			ddls = append(ddls, ddl)
+			ddls = append(ddls, createChange(ObjectTypeColumn, tableName, ddl).withColumn(desiredColumn.name))
 		} else {
 			// Change column data type or order as needed.
 			switch g.mode {
@@ -310,27 +425,31 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 						}
 						ddl += after
 					}
-					ddls = append(ddls, ddl)
+					destructive := g.isNarrowingDataType(*currentColumn, desiredColumn)
+					ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name).withDestructive(destructive))
 				}
 
 				// Add UNIQUE KEY. TODO: Probably it should be just normalized to an index after the parser phase.
 				currentIndex := findIndexByName(currentTable.indexes, desiredColumn.name)
 				if desiredColumn.keyOption.isUnique() && !currentColumn.keyOption.isUnique() && currentIndex == nil { // TODO: deal with a case that the index is not a UNIQUE KEY.
 					ddl := fmt.Sprintf("ALTER TABLE %s ADD UNIQUE KEY %s(%s)", g.escapeTableName(desired.table.name), g.escapeSQLName(desiredColumn.name), g.escapeSQLName(desiredColumn.name))
-					ddls = append(ddls, ddl)
+					ddls = append(ddls, createChange(ObjectTypeIndex, tableName, ddl).withName(desiredColumn.name))
 				}
 			case GeneratorModePostgres:
 				if !g.haveSameDataType(*currentColumn, desiredColumn) {
 					// Change type
 					ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", g.escapeTableName(desired.table.name), g.escapeSQLName(currentColumn.name), generateDataType(desiredColumn))
-					ddls = append(ddls, ddl)
+					destructive := g.isNarrowingDataType(*currentColumn, desiredColumn)
+					ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name).withDestructive(destructive))
 				}
 
 				if !isPrimaryKey(*currentColumn, currentTable) { // Primary Key implies NOT NULL
 					if g.notNull(*currentColumn) && !g.notNull(desiredColumn) {
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL", g.escapeTableName(desired.table.name), g.escapeSQLName(currentColumn.name)))
+						ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL", g.escapeTableName(desired.table.name), g.escapeSQLName(currentColumn.name))
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name))
 					} else if !g.notNull(*currentColumn) && g.notNull(desiredColumn) {
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", g.escapeTableName(desired.table.name), g.escapeSQLName(currentColumn.name)))
+						ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", g.escapeTableName(desired.table.name), g.escapeSQLName(currentColumn.name))
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name))
 					}
 				}
 
@@ -342,14 +461,16 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 						if desiredColumn.sequence != nil {
 							alter += " (" + generateSequenceClause(desiredColumn.sequence) + ")"
 						}
-						ddls = append(ddls, alter)
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, alter).withColumn(desiredColumn.name))
 					} else if desiredColumn.identity == nil {
 						// remove
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP IDENTITY IF EXISTS", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name)))
+						ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP IDENTITY IF EXISTS", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name))
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name))
 					} else {
 						// set
 						// not support changing sequence
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET GENERATED %s", g.escapeTableName(desired.table.name), g.escapeSQLName(desiredColumn.name), desiredColumn.identity.behavior))
+						ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET GENERATED %s", g.escapeTableName(desired.table.name), g.escapeSQLName(desiredColumn.name), desiredColumn.identity.behavior)
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(desiredColumn.name))
 					}
 				}
 
@@ -357,19 +478,21 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				if !areSameDefaultValue(currentColumn.defaultDef, desiredColumn.defaultDef) {
 					if desiredColumn.defaultDef == nil {
 						// drop
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name)))
+						ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name))
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name))
 					} else {
 						// set
 						definition, err := generateDefaultDefinition(*desiredColumn.defaultDef.value)
 						if err != nil {
 							return ddls, err
 						}
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name), definition))
+						ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name), definition)
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name))
 					}
 				}
 
-				_, tableName := postgres.SplitTableName(desired.table.name)
-				constraintName := fmt.Sprintf("%s_%s_check", tableName, desiredColumn.name)
+				_, unqualifiedTableName := postgres.SplitTableName(desired.table.name)
+				constraintName := fmt.Sprintf("%s_%s_check", unqualifiedTableName, desiredColumn.name)
 				if desiredColumn.check != nil && desiredColumn.check.constraintName != "" {
 					constraintName = desiredColumn.check.constraintName
 				}
@@ -385,14 +508,14 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				if !areSameCheckDefinition(currentCheck, desiredColumn.check) { // || currentColumn.checkNoInherit != desiredColumn.checkNoInherit {
 					if currentCheck != nil {
 						ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(desired.table.name), constraintName)
-						ddls = append(ddls, ddl)
+						ddls = append(ddls, dropChange(ObjectTypeCheck, tableName, ddl).withColumn(desiredColumn.name).withName(constraintName).withDestructive(desiredColumn.check == nil))
 					}
 					if desiredColumn.check != nil {
 						ddl := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", g.escapeTableName(desired.table.name), constraintName, desiredColumn.check.definition)
 						if desiredColumn.check.noInherit {
 							ddl += " NO INHERIT"
 						}
-						ddls = append(ddls, ddl)
+						ddls = append(ddls, createChange(ObjectTypeCheck, tableName, ddl).withColumn(desiredColumn.name).withName(constraintName))
 					}
 				}
 
@@ -403,7 +526,7 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 					if currentColumn.check != nil {
 						currentConstraintName := currentColumn.check.constraintName
 						ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(desired.table.name), currentConstraintName)
-						ddls = append(ddls, ddl)
+						ddls = append(ddls, dropChange(ObjectTypeCheck, tableName, ddl).withColumn(currentColumn.name).withName(currentConstraintName).withDestructive(desiredColumn.check == nil))
 					}
 					if desiredColumn.check != nil {
 						desiredConstraintName := desiredColumn.check.constraintName
@@ -415,7 +538,7 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 							replicationDefinition = " NOT FOR REPLICATION"
 						}
 						ddl := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK%s (%s)", g.escapeTableName(desired.table.name), desiredConstraintName, replicationDefinition, desiredColumn.check.definition)
-						ddls = append(ddls, ddl)
+						ddls = append(ddls, createChange(ObjectTypeCheck, tableName, ddl).withColumn(desiredColumn.name).withName(desiredConstraintName))
 					}
 				}
 
@@ -423,14 +546,16 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				if !areSameIdentityDefinition(currentColumn.identity, desiredColumn.identity) {
 					if currentColumn.identity != nil {
 						// remove
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name)))
+						ddl := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name))
+						ddls = append(ddls, dropChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name))
 					}
 					if desiredColumn.identity != nil {
 						definition, err := g.generateColumnDefinition(desiredColumn, true)
 						if err != nil {
 							return ddls, err
 						}
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ADD %s", g.escapeTableName(desired.table.name), definition))
+						ddl := fmt.Sprintf("ALTER TABLE %s ADD %s", g.escapeTableName(desired.table.name), definition)
+						ddls = append(ddls, createChange(ObjectTypeColumn, tableName, ddl).withColumn(desiredColumn.name))
 					}
 				}
 
@@ -438,7 +563,8 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				if !areSameDefaultValue(currentColumn.defaultDef, desiredColumn.defaultDef) {
 					if currentColumn.defaultDef != nil {
 						// drop
-						ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.defaultDef.constraintName)))
+						ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.defaultDef.constraintName))
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name).withName(currentColumn.defaultDef.constraintName))
 					}
 					if desiredColumn.defaultDef != nil {
 						// set
@@ -452,7 +578,7 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 						} else {
 							ddl = fmt.Sprintf("ALTER TABLE %s ADD %s FOR %s", g.escapeTableName(currentTable.name), definition, g.escapeSQLName(currentColumn.name))
 						}
-						ddls = append(ddls, ddl)
+						ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name).withName(desiredColumn.defaultDef.constraintName))
 					}
 				}
 			default:
@@ -470,7 +596,8 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				if err != nil {
 					return ddls, err
 				}
-				ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name), definition))
+				ddl := fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name), definition)
+				ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(currentColumn.name))
 			}
 		}
 	}
@@ -482,15 +609,17 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 		if currentPrimaryKey != nil {
 			switch g.mode {
 			case GeneratorModeMysql:
-				ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", g.escapeTableName(desired.table.name)))
+				ddl := fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", g.escapeTableName(desired.table.name))
+				ddls = append(ddls, dropChange(ObjectTypeIndex, tableName, ddl).withName(currentPrimaryKey.name).withDestructive(desiredPrimaryKey == nil))
 			case GeneratorModePostgres:
-				tableName := strings.SplitN(desired.table.name, ".", 2)[1] // without schema
-				ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(desired.table.name), g.escapeSQLName(tableName+"_pkey")))
+				unqualifiedTableName := strings.SplitN(desired.table.name, ".", 2)[1] // without schema
+				ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(desired.table.name), g.escapeSQLName(unqualifiedTableName+"_pkey"))
+				ddls = append(ddls, dropChange(ObjectTypeIndex, tableName, ddl).withName(unqualifiedTableName+"_pkey").withDestructive(desiredPrimaryKey == nil))
 			default:
 			}
 		}
 		if desiredPrimaryKey != nil {
-			ddls = append(ddls, g.generateAddIndex(desired.table.name, *desiredPrimaryKey))
+			ddls = append(ddls, createChange(ObjectTypeIndex, tableName, g.generateAddIndex(desired.table.name, *desiredPrimaryKey)).withName(desiredPrimaryKey.name))
 		}
 	}
 
@@ -503,12 +632,14 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 		if currentIndex := findIndexByName(currentTable.indexes, desiredIndex.name); currentIndex != nil {
 			// Drop and add index as needed.
 			if !areSameIndexes(*currentIndex, desiredIndex) {
-				ddls = append(ddls, g.generateDropIndex(desired.table.name, desiredIndex.name, desiredIndex.constraint))
-				ddls = append(ddls, g.generateAddIndex(desired.table.name, desiredIndex))
+				ddls = append(ddls, dropChange(ObjectTypeIndex, tableName, g.generateDropIndex(desired.table.name, desiredIndex.name, desiredIndex.constraint)).withName(desiredIndex.name).withDestructive(false))
+				ddls = append(ddls, createChange(ObjectTypeIndex, tableName, g.generateAddIndex(desired.table.name, desiredIndex)).withName(desiredIndex.name))
 			}
+		} else if renameDDL, ok := g.generateDDLForRenamedIndex(&currentTable, desiredIndex); ok {
+			ddls = append(ddls, renameDDL)
 		} else {
 			// Index not found, add index.
-			ddls = append(ddls, g.generateAddIndex(desired.table.name, desiredIndex))
+			ddls = append(ddls, createChange(ObjectTypeIndex, tableName, g.generateAddIndex(desired.table.name, desiredIndex)).withName(desiredIndex.name))
 		}
 	}
 
@@ -521,7 +652,8 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				if err != nil {
 					return ddls, err
 				}
-				ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s", g.escapeTableName(currentTable.name), g.escapeSQLName(desiredColumn.name), definition))
+				ddl := fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s", g.escapeTableName(currentTable.name), g.escapeSQLName(desiredColumn.name), definition)
+				ddls = append(ddls, alterChange(ObjectTypeColumn, tableName, ddl).withColumn(desiredColumn.name))
 			}
 		}
 	}
@@ -548,14 +680,18 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 				default:
 				}
 				if dropDDL != "" {
-					ddls = append(ddls, dropDDL, fmt.Sprintf("ALTER TABLE %s ADD %s", g.escapeTableName(desired.table.name), g.generateForeignKeyDefinition(desiredForeignKey)))
+					addDDL := fmt.Sprintf("ALTER TABLE %s ADD %s", g.escapeTableName(desired.table.name), g.generateForeignKeyDefinition(desiredForeignKey))
+					ddls = append(ddls,
+						dropChange(ObjectTypeForeignKey, tableName, dropDDL).withName(currentForeignKey.constraintName).withDestructive(false),
+						createChange(ObjectTypeForeignKey, tableName, addDDL).withName(desiredForeignKey.constraintName),
+					)
 				}
 			}
 		} else {
 			// Foreign key not found, add foreign key.
 			definition := g.generateForeignKeyDefinition(desiredForeignKey)
 			ddl := fmt.Sprintf("ALTER TABLE %s ADD %s", g.escapeTableName(desired.table.name), definition)
-			ddls = append(ddls, ddl)
+			ddls = append(ddls, createChange(ObjectTypeForeignKey, tableName, ddl).withName(desiredForeignKey.constraintName))
 		}
 	}
 
@@ -565,23 +701,243 @@ func (g *Generator) generateDDLsForCreateTable(currentTable Table, desired Creat
 			if !areSameCheckDefinition(currentCheck, &desiredCheck) {
 				switch g.mode {
 				case GeneratorModePostgres:
-					ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(desired.table.name), g.escapeSQLName(currentCheck.constraintName)))
-					ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", g.escapeTableName(desired.table.name), g.escapeSQLName(desiredCheck.constraintName), desiredCheck.definition))
+					dropDDL := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(desired.table.name), g.escapeSQLName(currentCheck.constraintName))
+					addDDL := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", g.escapeTableName(desired.table.name), g.escapeSQLName(desiredCheck.constraintName), desiredCheck.definition)
+					ddls = append(ddls,
+						dropChange(ObjectTypeCheck, tableName, dropDDL).withName(currentCheck.constraintName).withDestructive(false),
+						createChange(ObjectTypeCheck, tableName, addDDL).withName(desiredCheck.constraintName),
+					)
 				default:
 				}
 			}
 		} else {
-			ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", g.escapeTableName(desired.table.name), g.escapeSQLName(desiredCheck.constraintName), desiredCheck.definition))
+			ddl := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", g.escapeTableName(desired.table.name), g.escapeSQLName(desiredCheck.constraintName), desiredCheck.definition)
+			ddls = append(ddls, createChange(ObjectTypeCheck, tableName, ddl).withName(desiredCheck.constraintName))
 		}
 	}
 
 	return ddls, nil
 }
 
+// Rename a table annotated with `-- @renamed from` if the old table exists. This simulates the rename in `g.currentTables`.
+func (g *Generator) generateDDLsForRenamedTable(desired Table) ([]Change, error) {
+	ddls := []Change{}
+
+	currentTable := findTableByName(g.currentTables, desired.renamedFrom)
+	if currentTable == nil {
+		return ddls, nil // Not renamed from an existing table. It's just created.
+	}
+
+	var ddl string
+	switch g.mode {
+	case GeneratorModePostgres:
+		currentSchema, _ := postgres.SplitTableName(currentTable.name)
+		desiredSchema, desiredTableName := postgres.SplitTableName(desired.name)
+		if currentSchema != desiredSchema {
+			return ddls, fmt.Errorf("renaming table '%s' to '%s' changes its schema, which is not supported", currentTable.name, desired.name)
+		}
+		ddl = fmt.Sprintf("ALTER TABLE %s RENAME TO %s", g.escapeTableName(currentTable.name), g.escapeSQLName(desiredTableName))
+	case GeneratorModeMssql:
+		desiredTableName := desired.name[strings.LastIndex(desired.name, ".")+1:] // sp_rename takes an unqualified new name
+		ddl = fmt.Sprintf("EXEC sp_rename '%s', '%s'", currentTable.name, desiredTableName)
+	default:
+		ddl = fmt.Sprintf("ALTER TABLE %s RENAME TO %s", g.escapeTableName(currentTable.name), g.escapeTableName(desired.name))
+	}
+	ddls = append(ddls, renameChange(ObjectTypeTable, desired.name, currentTable.name, ddl))
+
+	// Foreign keys follow the renamed table
+	for _, table := range g.currentTables {
+		for i := range table.foreignKeys {
+			if table.foreignKeys[i].referenceName == currentTable.name {
+				table.foreignKeys[i].referenceName = desired.name
+			}
+		}
+	}
+	currentTable.name = desired.name
+
+	return ddls, nil
+}
+
+// Rename columns annotated with `-- @renamed from` if the old column exists. This simulates the rename in `currentTable`.
+func (g *Generator) generateDDLsForRenamedColumns(currentTable *Table, desired Table) ([]Change, error) {
+	ddls := []Change{}
+
+	for _, desiredColumn := range desired.columns {
+		if desiredColumn.renamedFrom == "" || findColumnByName(currentTable.columns, desiredColumn.name) != nil {
+			continue // Not renamed, or already renamed.
+		}
+
+		for i, currentColumn := range currentTable.columns {
+			if currentColumn.name != desiredColumn.renamedFrom {
+				continue
+			}
+
+			var ddl string
+			switch g.mode {
+			case GeneratorModeMysql:
+				// CHANGE COLUMN works before MySQL 8.0 unlike RENAME COLUMN. The definition is changed later if needed.
+				renamedColumn := currentColumn
+				renamedColumn.name = desiredColumn.name
+				definition, err := g.generateColumnDefinition(renamedColumn, false)
+				if err != nil {
+					return ddls, err
+				}
+				ddl = fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name), definition)
+			case GeneratorModeMssql:
+				ddl = fmt.Sprintf("EXEC sp_rename '%s.%s', '%s', 'COLUMN'", currentTable.name, currentColumn.name, desiredColumn.name)
+			default:
+				ddl = fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentColumn.name), g.escapeSQLName(desiredColumn.name))
+			}
+			change := renameChange(ObjectTypeColumn, desired.name, currentColumn.name, ddl).withColumn(desiredColumn.name)
+			if desiredColumn.renameDetected {
+				change = change.withDetected()
+			}
+			ddls = append(ddls, change)
+
+			renameColumnReferences(currentTable, currentColumn.name, desiredColumn.name)
+			currentTable.columns[i].name = desiredColumn.name
+			break
+		}
+	}
+
+	return ddls, nil
+}
+
+// Rename an index whose `renamedFrom` is set by detectRenamedIndexes. This simulates the rename in `currentTable`.
+func (g *Generator) generateDDLForRenamedIndex(currentTable *Table, desiredIndex Index) (Change, bool) {
+	if desiredIndex.renamedFrom == "" {
+		return Change{}, false
+	}
+	for i, currentIndex := range currentTable.indexes {
+		if currentIndex.name != desiredIndex.renamedFrom {
+			continue
+		}
+
+		var ddl string
+		switch g.mode {
+		case GeneratorModeMysql:
+			ddl = fmt.Sprintf("ALTER TABLE %s RENAME INDEX %s TO %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentIndex.name), g.escapeSQLName(desiredIndex.name))
+		case GeneratorModePostgres:
+			if currentIndex.constraint {
+				ddl = fmt.Sprintf("ALTER TABLE %s RENAME CONSTRAINT %s TO %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentIndex.name), g.escapeSQLName(desiredIndex.name))
+			} else {
+				schema, _ := postgres.SplitTableName(currentTable.name)
+				ddl = fmt.Sprintf("ALTER INDEX %s.%s RENAME TO %s", g.escapeSQLName(schema), g.escapeSQLName(currentIndex.name), g.escapeSQLName(desiredIndex.name))
+			}
+		case GeneratorModeMssql:
+			ddl = fmt.Sprintf("EXEC sp_rename '%s.%s', '%s', 'INDEX'", currentTable.name, currentIndex.name, desiredIndex.name)
+		default:
+			return Change{}, false
+		}
+
+		currentTable.indexes[i].name = desiredIndex.name
+		return renameChange(ObjectTypeIndex, currentTable.name, currentIndex.name, ddl).withName(desiredIndex.name).withDetected(), true
+	}
+	return Change{}, false
+}
+
+// For --detect-renames. Set `renamedFrom` of a desired column if the current table has exactly one
+// column that is absent from the desired table and has the same definition and position.
+func (g *Generator) detectRenamedColumns(currentTable Table, desired *Table) {
+	desiredNames := convertColumnsToColumnNames(desired.columns)
+	currentNames := convertColumnsToColumnNames(currentTable.columns)
+	renamedFrom := map[string][]int{} // current column name -> indexes of desired columns
+	for i, desiredColumn := range desired.columns {
+		if desiredColumn.renamedFrom != "" || containsString(currentNames, desiredColumn.name) {
+			continue
+		}
+		var candidates []string
+		for _, currentColumn := range currentTable.columns {
+			if !containsString(desiredNames, currentColumn.name) && currentColumn.position == desiredColumn.position &&
+				g.haveSameColumnDefinition(currentColumn, desiredColumn) && areSameDefaultValue(currentColumn.defaultDef, desiredColumn.defaultDef) {
+				candidates = append(candidates, currentColumn.name)
+			}
+		}
+		if len(candidates) == 1 {
+			renamedFrom[candidates[0]] = append(renamedFrom[candidates[0]], i)
+		}
+	}
+	for currentName, desiredIndexes := range renamedFrom {
+		if len(desiredIndexes) == 1 {
+			desired.columns[desiredIndexes[0]].renamedFrom = currentName
+			desired.columns[desiredIndexes[0]].renameDetected = true
+		}
+	}
+}
+
+// For --detect-renames. Set `renamedFrom` of desired indexes which are the same as exactly one current
+// index that is absent from the desired schema.
+func (g *Generator) detectRenamedIndexes(desiredDDLs []DDL) {
+	desiredIndexes := map[string][]*Index{} // table name -> indexes
+	for _, ddl := range desiredDDLs {
+		switch desired := ddl.(type) {
+		case *CreateTable:
+			for i := range desired.table.indexes {
+				desiredIndexes[desired.table.name] = append(desiredIndexes[desired.table.name], &desired.table.indexes[i])
+			}
+		case *CreateIndex:
+			desiredIndexes[desired.tableName] = append(desiredIndexes[desired.tableName], &desired.index)
+		case *AddIndex:
+			desiredIndexes[desired.tableName] = append(desiredIndexes[desired.tableName], &desired.index)
+		}
+	}
+
+	for tableName, indexes := range desiredIndexes {
+		currentTable := findTableByName(g.currentTables, tableName)
+		if currentTable == nil {
+			continue
+		}
+		desiredNames := []string{}
+		for _, index := range indexes {
+			desiredNames = append(desiredNames, index.name)
+		}
+
+		renamedFrom := map[string][]*Index{} // current index name -> desired indexes
+		for _, desiredIndex := range indexes {
+			if desiredIndex.primary || findIndexByName(currentTable.indexes, desiredIndex.name) != nil {
+				continue
+			}
+			var candidates []string
+			for _, currentIndex := range currentTable.indexes {
+				if !currentIndex.primary && !containsString(desiredNames, currentIndex.name) &&
+					currentIndex.constraint == desiredIndex.constraint && areSameIndexes(currentIndex, *desiredIndex) {
+					candidates = append(candidates, currentIndex.name)
+				}
+			}
+			if len(candidates) == 1 {
+				renamedFrom[candidates[0]] = append(renamedFrom[candidates[0]], desiredIndex)
+			}
+		}
+		for currentName, desiredIndexes := range renamedFrom {
+			if len(desiredIndexes) == 1 {
+				desiredIndexes[0].renamedFrom = currentName
+			}
+		}
+	}
+}
+
+// Indexes and foreign keys follow the renamed column
+func renameColumnReferences(table *Table, oldName string, newName string) {
+	for i := range table.indexes {
+		for j := range table.indexes[i].columns {
+			if table.indexes[i].columns[j].column == oldName {
+				table.indexes[i].columns[j].column = newName
+			}
+		}
+	}
+	for i := range table.foreignKeys {
+		for j := range table.foreignKeys[i].indexColumns {
+			if table.foreignKeys[i].indexColumns[j] == oldName {
+				table.foreignKeys[i].indexColumns[j] = newName
+			}
+		}
+	}
+}
+
 // Shared by `CREATE INDEX` and `ALTER TABLE ADD INDEX`.
 // This manages `g.currentTables` unlike `generateDDLsForCreateTable`...
-func (g *Generator) generateDDLsForCreateIndex(tableName string, desiredIndex Index, action string, statement string) ([]string, error) {
-	ddls := []string{}
+func (g *Generator) generateDDLsForCreateIndex(tableName string, desiredIndex Index, action string, statement string) ([]Change, error) {
+	ddls := []Change{}
 
 	currentTable := findTableByName(g.currentTables, tableName)
 	if currentTable == nil {
@@ -589,15 +945,21 @@ func (g *Generator) generateDDLsForCreateIndex(tableName string, desiredIndex In
 	}
 
 	currentIndex := findIndexByName(currentTable.indexes, desiredIndex.name)
+	if currentIndex == nil && desiredIndex.renamedFrom != "" {
+		if renameDDL, ok := g.generateDDLForRenamedIndex(currentTable, desiredIndex); ok {
+			ddls = append(ddls, renameDDL)
+			currentIndex = findIndexByName(currentTable.indexes, desiredIndex.name)
+		}
+	}
 	if currentIndex == nil {
 		// Index not found, add index.
-		ddls = append(ddls, statement)
+		ddls = append(ddls, createChange(ObjectTypeIndex, tableName, statement).withName(desiredIndex.name))
 		currentTable.indexes = append(currentTable.indexes, desiredIndex)
 	} else {
 		// Index found. If it's different, drop and add index.
 		if !areSameIndexes(*currentIndex, desiredIndex) {
-			ddls = append(ddls, g.generateDropIndex(currentTable.name, currentIndex.name, currentIndex.constraint))
-			ddls = append(ddls, statement)
+			ddls = append(ddls, dropChange(ObjectTypeIndex, tableName, g.generateDropIndex(currentTable.name, currentIndex.name, currentIndex.constraint)).withName(currentIndex.name).withDestructive(false))
+			ddls = append(ddls, createChange(ObjectTypeIndex, tableName, statement).withName(desiredIndex.name))
 
 			newIndexes := []Index{}
 			for _, currentIndex := range currentTable.indexes {
@@ -616,16 +978,18 @@ func (g *Generator) generateDDLsForCreateIndex(tableName string, desiredIndex In
 	if desiredTable == nil {
 		return nil, fmt.Errorf("%s is performed before create table '%s': '%s'", action, tableName, statement)
 	}
+	indexKey := objectKey{objectType: ObjectTypeIndex, table: tableName, name: desiredIndex.name}
 	if containsString(convertIndexesToIndexNames(desiredTable.indexes), desiredIndex.name) {
-		return nil, fmt.Errorf("index '%s' is doubly created against table '%s': '%s'", desiredIndex.name, tableName, statement)
+		return nil, fmt.Errorf("index '%s' is doubly created against table '%s' (%s): '%s'", desiredIndex.name, tableName, g.doublyCreatedAt(indexKey), statement)
 	}
 	desiredTable.indexes = append(desiredTable.indexes, desiredIndex)
+	g.defineDesired(indexKey)
 
 	return ddls, nil
 }
 
-func (g *Generator) generateDDLsForAddForeignKey(tableName string, desiredForeignKey ForeignKey, action string, statement string) ([]string, error) {
-	var ddls []string
+func (g *Generator) generateDDLsForAddForeignKey(tableName string, desiredForeignKey ForeignKey, action string, statement string) ([]Change, error) {
+	var ddls []Change
 
 	// TODO: Simulate currentTable.foreignKeys too
 
@@ -634,16 +998,18 @@ func (g *Generator) generateDDLsForAddForeignKey(tableName string, desiredForeig
 	if desiredTable == nil {
 		return nil, fmt.Errorf("%s is performed before create table '%s': '%s'", action, tableName, statement)
 	}
+	foreignKeyKey := objectKey{objectType: ObjectTypeForeignKey, table: tableName, name: desiredForeignKey.constraintName}
 	if containsString(convertForeignKeysToConstraintNames(desiredTable.foreignKeys), desiredForeignKey.constraintName) {
-		return nil, fmt.Errorf("index '%s' is doubly created against table '%s': '%s'", desiredForeignKey.constraintName, tableName, statement)
+		return nil, fmt.Errorf("index '%s' is doubly created against table '%s' (%s): '%s'", desiredForeignKey.constraintName, tableName, g.doublyCreatedAt(foreignKeyKey), statement)
 	}
 	desiredTable.foreignKeys = append(desiredTable.foreignKeys, desiredForeignKey)
+	g.defineDesired(foreignKeyKey)
 
 	return ddls, nil
 }
 
-func (g *Generator) generateDDLsForCreatePolicy(tableName string, desiredPolicy Policy, action string, statement string) ([]string, error) {
-	var ddls []string
+func (g *Generator) generateDDLsForCreatePolicy(tableName string, desiredPolicy Policy, action string, statement string) ([]Change, error) {
+	var ddls []Change
 
 	currentTable := findTableByName(g.currentTables, tableName)
 	if currentTable == nil {
@@ -653,13 +1019,14 @@ func (g *Generator) generateDDLsForCreatePolicy(tableName string, desiredPolicy
 	currentPolicy := findPolicyByName(currentTable.policies, desiredPolicy.name)
 	if currentPolicy == nil {
 		// Policy not found, add policy.
-		ddls = append(ddls, statement)
+		ddls = append(ddls, createChange(ObjectTypePolicy, tableName, statement).withName(desiredPolicy.name))
 		currentTable.policies = append(currentTable.policies, desiredPolicy)
 	} else {
 		// policy found. If it's different, drop and add or alter policy.
 		if !areSamePolicies(*currentPolicy, desiredPolicy) {
-			ddls = append(ddls, fmt.Sprintf("DROP POLICY %s ON %s", g.escapeSQLName(currentPolicy.name), g.escapeTableName(currentTable.name)))
-			ddls = append(ddls, statement)
+			ddl := fmt.Sprintf("DROP POLICY %s ON %s", g.escapeSQLName(currentPolicy.name), g.escapeTableName(currentTable.name))
+			ddls = append(ddls, dropChange(ObjectTypePolicy, tableName, ddl).withName(currentPolicy.name).withDestructive(false))
+			ddls = append(ddls, createChange(ObjectTypePolicy, tableName, statement).withName(desiredPolicy.name))
 		}
 	}
 
@@ -668,44 +1035,48 @@ func (g *Generator) generateDDLsForCreatePolicy(tableName string, desiredPolicy
 	if desiredTable == nil {
 		return nil, fmt.Errorf("%s is performed before create table '%s': '%s'", action, tableName, statement)
 	}
+	policyKey := objectKey{objectType: ObjectTypePolicy, table: tableName, name: desiredPolicy.name}
 	if containsString(convertPolicyNames(desiredTable.policies), desiredPolicy.name) {
-		return nil, fmt.Errorf("policy '%s' is doubly created against table '%s': '%s'", desiredPolicy.name, tableName, statement)
+		return nil, fmt.Errorf("policy '%s' is doubly created against table '%s' (%s): '%s'", desiredPolicy.name, tableName, g.doublyCreatedAt(policyKey), statement)
 	}
 	desiredTable.policies = append(desiredTable.policies, desiredPolicy)
+	g.defineDesired(policyKey)
 
 	return ddls, nil
 }
 
-func (g *Generator) generateDDLsForCreateView(viewName string, desiredView *View) ([]string, error) {
-	var ddls []string
+func (g *Generator) generateDDLsForCreateView(viewName string, desiredView *View) ([]Change, error) {
+	var ddls []Change
 
 	currentView := findViewByName(g.currentViews, viewName)
 	if currentView == nil {
 		// View not found, add view.
-		ddls = append(ddls, desiredView.statement)
+		ddls = append(ddls, createChange(ObjectTypeView, viewName, desiredView.statement))
 	} else {
 		// View found. If it's different, create or replace view.
 		if strings.ToLower(currentView.definition) != strings.ToLower(desiredView.definition) {
 			if g.mode == GeneratorModeSQLite3 || g.mode == GeneratorModeMssql {
-				ddls = append(ddls, fmt.Sprintf("DROP VIEW %s", g.escapeTableName(viewName)))
-				ddls = append(ddls, fmt.Sprintf("CREATE VIEW %s AS %s", g.escapeTableName(viewName), desiredView.definition))
+				ddls = append(ddls, dropChange(ObjectTypeView, viewName, fmt.Sprintf("DROP VIEW %s", g.escapeTableName(viewName))).withDestructive(false))
+				ddls = append(ddls, createChange(ObjectTypeView, viewName, fmt.Sprintf("CREATE VIEW %s AS %s", g.escapeTableName(viewName), desiredView.definition)))
 			} else {
-				ddls = append(ddls, fmt.Sprintf("CREATE OR REPLACE VIEW %s AS %s", g.escapeTableName(viewName), desiredView.definition))
+				ddls = append(ddls, alterChange(ObjectTypeView, viewName, fmt.Sprintf("CREATE OR REPLACE VIEW %s AS %s", g.escapeTableName(viewName), desiredView.definition)))
 			}
 		}
 	}
 
 	// Examine policies in desiredTable to delete obsoleted policies later
+	viewKey := objectKey{objectType: ObjectTypeView, name: desiredView.name}
 	if containsString(convertViewNames(g.desiredViews), desiredView.name) {
-		return nil, fmt.Errorf("view '%s' is doubly created: '%s'", desiredView.name, desiredView.statement)
+		return nil, fmt.Errorf("view '%s' is doubly created (%s): '%s'", desiredView.name, g.doublyCreatedAt(viewKey), desiredView.statement)
 	}
 	g.desiredViews = append(g.desiredViews, desiredView)
+	g.defineDesired(viewKey)
 
 	return ddls, nil
 }
 
-func (g *Generator) generateDDLsForCreateTrigger(triggerName string, desiredTrigger *Trigger) ([]string, error) {
-	var ddls []string
+func (g *Generator) generateDDLsForCreateTrigger(triggerName string, desiredTrigger *Trigger) ([]Change, error) {
+	var ddls []Change
 	currentTrigger := findTriggerByName(g.currentTriggers, triggerName)
 
 	var triggerDefinition string
@@ -720,17 +1091,16 @@ func (g *Generator) generateDDLsForCreateTrigger(triggerName string, desiredTrig
 
 	if currentTrigger == nil {
 		// Trigger not found, add trigger.
-		ddls = append(ddls, fmt.Sprintf("CREATE %s", triggerDefinition))
+		ddls = append(ddls, createChange(ObjectTypeTrigger, desiredTrigger.tableName, fmt.Sprintf("CREATE %s", triggerDefinition)).withName(triggerName))
 	} else {
 		// Trigger found. If it's different, create or replace trigger.
 		if !areSameTriggerDefinition(currentTrigger, desiredTrigger) {
-			createPrefix := "CREATE "
 			if g.mode == GeneratorModeMssql {
-				createPrefix += "OR ALTER "
+				ddls = append(ddls, alterChange(ObjectTypeTrigger, desiredTrigger.tableName, "CREATE OR ALTER "+triggerDefinition).withName(triggerName))
 			} else {
-				ddls = append(ddls, fmt.Sprintf("DROP TRIGGER %s", g.escapeSQLName(triggerName)))
+				ddls = append(ddls, dropChange(ObjectTypeTrigger, currentTrigger.tableName, fmt.Sprintf("DROP TRIGGER %s", g.escapeSQLName(triggerName))).withName(triggerName).withDestructive(false))
+				ddls = append(ddls, createChange(ObjectTypeTrigger, desiredTrigger.tableName, "CREATE "+triggerDefinition).withName(triggerName))
 			}
-			ddls = append(ddls, createPrefix+triggerDefinition)
 		}
 	}
 
@@ -739,13 +1109,13 @@ func (g *Generator) generateDDLsForCreateTrigger(triggerName string, desiredTrig
 	return ddls, nil
 }
 
-func (g *Generator) generateDDLsForCreateType(desired *Type) ([]string, error) {
-	ddls := []string{}
+func (g *Generator) generateDDLsForCreateType(desired *Type) ([]Change, error) {
+	ddls := []Change{}
 
 	currentType := findTypeByName(g.currentTypes, desired.name)
 	if currentType == nil {
 		// Type not found, add type.
-		ddls = append(ddls, desired.statement)
+		ddls = append(ddls, createChange(ObjectTypeType, desired.name, desired.statement))
 	}
 	g.desiredTypes = append(g.desiredTypes, desired)
 
@@ -754,12 +1124,13 @@ func (g *Generator) generateDDLsForCreateType(desired *Type) ([]string, error) {
 
 // Even though simulated table doesn't have a foreign key, references could exist in column definitions.
 // This carefully generates DROP CONSTRAINT for such situations.
-func (g *Generator) generateDDLsForAbsentForeignKey(currentForeignKey ForeignKey, currentTable Table, desiredTable Table) []string {
-	ddls := []string{}
+func (g *Generator) generateDDLsForAbsentForeignKey(currentForeignKey ForeignKey, currentTable Table, desiredTable Table) []Change {
+	ddls := []Change{}
 
 	switch g.mode {
 	case GeneratorModeMysql:
-		ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentForeignKey.constraintName)))
+		ddl := fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentForeignKey.constraintName))
+		ddls = append(ddls, dropChange(ObjectTypeForeignKey, currentTable.name, ddl).withName(currentForeignKey.constraintName))
 	case GeneratorModePostgres, GeneratorModeMssql:
 		var referencesColumn *Column
 		for _, column := range desiredTable.columns {
@@ -770,7 +1141,8 @@ func (g *Generator) generateDDLsForAbsentForeignKey(currentForeignKey ForeignKey
 		}
 
 		if referencesColumn == nil {
-			ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentForeignKey.constraintName)))
+			ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentForeignKey.constraintName))
+			ddls = append(ddls, dropChange(ObjectTypeForeignKey, currentTable.name, ddl).withName(currentForeignKey.constraintName))
 		}
 	default:
 	}
@@ -780,8 +1152,8 @@ func (g *Generator) generateDDLsForAbsentForeignKey(currentForeignKey ForeignKey
 
 // Even though simulated table doesn't have an index, primary or unique could exist in column definitions.
 // This carefully generates DROP INDEX for such situations.
-func (g *Generator) generateDDLsForAbsentIndex(currentIndex Index, currentTable Table, desiredTable Table) ([]string, error) {
-	ddls := []string{}
+func (g *Generator) generateDDLsForAbsentIndex(currentIndex Index, currentTable Table, desiredTable Table) ([]Change, error) {
+	ddls := []Change{}
 
 	if currentIndex.primary {
 		var primaryKeyColumn *Column
@@ -796,7 +1168,8 @@ func (g *Generator) generateDDLsForAbsentIndex(currentIndex Index, currentTable
 			// If nil, it will be `DROP COLUMN`-ed and we can usually ignore it.
 			// However, it seems like you need to explicitly drop it first for MSSQL.
 			if g.mode == GeneratorModeMssql && (primaryKeyColumn == nil || primaryKeyColumn.name != currentIndex.columns[0].column) {
-				ddls = append(ddls, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentIndex.name)))
+				ddl := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.escapeTableName(currentTable.name), g.escapeSQLName(currentIndex.name))
+				ddls = append(ddls, dropChange(ObjectTypeIndex, currentTable.name, ddl).withName(currentIndex.name))
 			}
 		} else if primaryKeyColumn.name != currentIndex.columns[0].column { // TODO: check length of currentIndex.columns
 			// TODO: handle this. Rename primary key column...?
@@ -819,10 +1192,10 @@ func (g *Generator) generateDDLsForAbsentIndex(currentIndex Index, currentTable
 
 		if uniqueKeyColumn == nil {
 			// No unique column. Drop unique key index.
-			ddls = append(ddls, g.generateDropIndex(currentTable.name, currentIndex.name, currentIndex.constraint))
+			ddls = append(ddls, dropChange(ObjectTypeIndex, currentTable.name, g.generateDropIndex(currentTable.name, currentIndex.name, currentIndex.constraint)).withName(currentIndex.name))
 		}
 	} else {
-		ddls = append(ddls, g.generateDropIndex(currentTable.name, currentIndex.name, currentIndex.constraint))
+		ddls = append(ddls, dropChange(ObjectTypeIndex, currentTable.name, g.generateDropIndex(currentTable.name, currentIndex.name, currentIndex.constraint)).withName(currentIndex.name))
 	}
 
 	return ddls, nil
@@ -1110,7 +1483,7 @@ func (g *Generator) escapeTableName(name string) string {
 		if len(schemaTable) == 1 {
 			switch g.mode {
 			case GeneratorModePostgres:
-				schemaName, tableName = "public", schemaTable[0]
+				schemaName, tableName = g.options.DefaultSchema, schemaTable[0]
 			case GeneratorModeMssql:
 				schemaName, tableName = "dbo", schemaTable[0]
 			}
@@ -1272,6 +1645,66 @@ func convertDDLsToTypes(ddls []DDL) []*Type {
 	return types
 }
 
+// Remove DDLs of objects rejected by the filter
+func filterDDLs(ddls []DDL, offsets []int, filter func(string) bool) ([]DDL, []int) {
+	var filteredDDLs []DDL
+	var filteredOffsets []int
+	for i, ddl := range ddls {
+		if name := filteredName(ddl); name == "" || filter(name) {
+			filteredDDLs = append(filteredDDLs, ddl)
+			filteredOffsets = append(filteredOffsets, offsets[i])
+		}
+	}
+	return filteredDDLs, filteredOffsets
+}
+
+// Remove DDLs of objects outside the Postgres schemas. Unqualified names are in defaultSchema, except tables of
+// triggers, which are not qualified even when they're in another schema.
+func filterDDLsBySchemas(ddls []DDL, offsets []int, schemas []string, defaultSchema string) ([]DDL, []int) {
+	var filteredDDLs []DDL
+	var filteredOffsets []int
+	for i, ddl := range ddls {
+		name := filteredName(ddl)
+		if _, ok := ddl.(*Trigger); ok && !strings.Contains(name, ".") {
+			name = "" // kept, since the schema of the trigger's table is unknown
+		} else if name != "" && !strings.Contains(name, ".") {
+			name = defaultSchema + "." + name
+		}
+		if schema, _ := postgres.SplitTableName(name); name != "" && !containsString(schemas, schema) {
+			continue
+		}
+		filteredDDLs = append(filteredDDLs, ddl)
+		filteredOffsets = append(filteredOffsets, offsets[i])
+	}
+	return filteredDDLs, filteredOffsets
+}
+
+// Return the name of the table, view or type which decides whether the DDL is filtered
+func filteredName(ddl DDL) string {
+	switch ddl := ddl.(type) {
+	case *CreateTable:
+		return ddl.table.name
+	case *CreateIndex:
+		return ddl.tableName
+	case *AddIndex:
+		return ddl.tableName
+	case *AddPrimaryKey:
+		return ddl.tableName
+	case *AddForeignKey:
+		return ddl.tableName
+	case *AddPolicy:
+		return ddl.tableName
+	case *Trigger:
+		return ddl.tableName
+	case *View:
+		return ddl.name
+	case *Type:
+		return ddl.name
+	default:
+		return ""
+	}
+}
+
 func findTableByName(tables []*Table, name string) *Table {
 	for _, table := range tables {
 		if table.name == name {
@@ -1383,6 +1816,100 @@ func (g *Generator) haveSameDataType(current Column, desired Column) bool {
 	// TODO: scale
 }
 
+// Return true if the desired type may not hold every value of the current column, i.e. changing the type may
+// truncate data or fail. Unknown conversions are considered narrowing.
+func (g *Generator) isNarrowingDataType(current Column, desired Column) bool {
+	currentType := g.normalizeDataType(current.typeName)
+	desiredType := g.normalizeDataType(desired.typeName)
+	if current.array != desired.array {
+		return true
+	}
+
+	// Any value can be stored as an unlimited text
+	desiredSize, desiredIsText := g.textTypeSize(desired)
+	if desiredIsText && desiredSize < 0 {
+		return false
+	}
+
+	if currentSize, ok := integerTypeSizes[currentType]; ok {
+		if desiredSize, ok := integerTypeSizes[desiredType]; ok {
+			if current.unsigned == desired.unsigned {
+				return desiredSize < currentSize
+			}
+			return desired.unsigned || desiredSize <= currentSize // signed -> unsigned loses negative values
+		}
+		return true
+	}
+	if currentSize, ok := g.textTypeSize(current); ok && desiredIsText {
+		return currentSize < 0 || desiredSize < currentSize
+	}
+	if currentSize, ok := floatTypeSizes[currentType]; ok {
+		desiredSize, ok := floatTypeSizes[desiredType]
+		return !ok || desiredSize < currentSize
+	}
+	if currentType != desiredType {
+		return true
+	}
+
+	switch currentType {
+	case "numeric", "decimal":
+		if current.length == nil && desired.length == nil {
+			return false
+		} else if desired.length == nil {
+			return g.mode != GeneratorModePostgres // numeric without precision is unlimited in Postgres
+		}
+		currentScale, desiredScale := 0, 0
+		if current.scale != nil {
+			currentScale = current.scale.intVal
+		}
+		if desired.scale != nil {
+			desiredScale = desired.scale.intVal
+		}
+		return current.length == nil || desiredScale < currentScale ||
+			desired.length.intVal-desiredScale < current.length.intVal-currentScale
+	case "enum", "set":
+		for _, value := range current.enumValues {
+			if !containsString(desired.enumValues, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return current.length != nil && desired.length != nil && desired.length.intVal < current.length.intVal
+	}
+}
+
+// Return the maximum length of a text type, -1 for unlimited, and false if it's not a text type.
+func (g *Generator) textTypeSize(column Column) (int64, bool) {
+	switch g.normalizeDataType(column.typeName) {
+	case "character varying", "nvarchar", "varbinary":
+		if column.length == nil {
+			return -1, true // e.g. Postgres `varchar` without length
+		}
+		return int64(column.length.intVal), true
+	case "character", "nchar", "binary":
+		if column.length == nil {
+			return 1, true
+		}
+		return int64(column.length.intVal), true
+	case "text":
+		if g.mode == GeneratorModeMysql {
+			return 65535, true
+		}
+		return -1, true
+	case "tinytext", "tinyblob":
+		return 255, true
+	case "blob":
+		return 65535, true
+	case "mediumtext", "mediumblob":
+		return 16777215, true
+	case "longtext", "longblob":
+		return 4294967295, true
+	default:
+		return 0, false
+	}
+}
+
 func areSameCheckDefinition(checkA *CheckDefinition, checkB *CheckDefinition) bool {
 	if checkA == nil && checkB == nil {
 		return true
@@ -94,7 +94,7 @@ func parseLength(val *sqlparser.SQLVal) (*int, error) {
 	return &intVal, nil
 }
 
-func parseTable(mode GeneratorMode, stmt *sqlparser.DDL) (Table, error) {
+func parseTable(mode GeneratorMode, defaultSchema string, stmt *sqlparser.DDL) (Table, error) {
 	var columns []Column
 	var indexes []Index
 	var checks []CheckDefinition
@@ -119,7 +119,7 @@ func parseTable(mode GeneratorMode, stmt *sqlparser.DDL) (Table, error) {
 			onUpdate:      parseValue(parsedCol.Type.OnUpdate),
 			comment:       parseValue(parsedCol.Type.Comment),
 			enumValues:    parsedCol.Type.EnumValues,
-			references:    normalizedTable(mode, parsedCol.Type.References),
+			references:    normalizedTable(mode, defaultSchema, parsedCol.Type.References),
 			identity:      parseIdentity(parsedCol.Type.Identity),
 			sequence:      parseIdentitySequence(parsedCol.Type.Identity),
 		}
@@ -216,7 +216,7 @@ func parseTable(mode GeneratorMode, stmt *sqlparser.DDL) (Table, error) {
 	}
 
 	return Table{
-		name:        normalizedTableName(mode, stmt.NewName),
+		name:        normalizedTableName(mode, defaultSchema, stmt.NewName),
 		columns:     columns,
 		indexes:     indexes,
 		checks:      checks,
@@ -303,7 +303,7 @@ func parseIndex(stmt *sqlparser.DDL) (Index, error) {
 
 // Parse DDL like `CREATE TABLE` or `ALTER TABLE`.
 // This doesn't support destructive DDL like `DROP TABLE`.
-func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
+func parseDDL(mode GeneratorMode, defaultSchema string, ddl string) (DDL, error) {
 	var parserMode sqlparser.ParserMode
 	switch mode {
 	case GeneratorModeMysql:
@@ -318,6 +318,9 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 		panic("unrecognized parser mode")
 	}
 
+	if mode == GeneratorModePostgres {
+		ddl = removeConcurrently(ddl)
+	}
 	stmt, err := sqlparser.ParseStrictDDLWithMode(ddl, parserMode)
 	if err != nil {
 		return nil, err
@@ -327,10 +330,18 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 	case *sqlparser.DDL:
 		if stmt.Action == sqlparser.CreateStr {
 			// TODO: handle other create DDL as error?
-			table, err := parseTable(mode, stmt)
+			table, err := parseTable(mode, defaultSchema, stmt)
 			if err != nil {
 				return nil, err
 			}
+			if err := parseRenameAnnotations(mode, defaultSchema, ddl, &table); err != nil {
+				return nil, err
+			}
+			if mode == GeneratorModeMysql {
+				if err := parseAlterAnnotations(ddl, &table); err != nil {
+					return nil, err
+				}
+			}
 			return &CreateTable{
 				statement: ddl,
 				table:     table,
@@ -342,7 +353,7 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 			}
 			return &CreateIndex{
 				statement: ddl,
-				tableName: normalizedTableName(mode, stmt.Table),
+				tableName: normalizedTableName(mode, defaultSchema, stmt.Table),
 				index:     index,
 			}, nil
 		} else if stmt.Action == sqlparser.AddIndexStr {
@@ -352,7 +363,7 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 			}
 			return &AddIndex{
 				statement: ddl,
-				tableName: normalizedTableName(mode, stmt.Table),
+				tableName: normalizedTableName(mode, defaultSchema, stmt.Table),
 				index:     index,
 			}, nil
 		} else if stmt.Action == sqlparser.AddPrimaryKeyStr {
@@ -362,7 +373,7 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 			}
 			return &AddPrimaryKey{
 				statement: ddl,
-				tableName: normalizedTableName(mode, stmt.Table),
+				tableName: normalizedTableName(mode, defaultSchema, stmt.Table),
 				index:     index,
 			}, nil
 		} else if stmt.Action == sqlparser.AddForeignKeyStr {
@@ -377,7 +388,7 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 
 			return &AddForeignKey{
 				statement: ddl,
-				tableName: normalizedTableName(mode, stmt.Table),
+				tableName: normalizedTableName(mode, defaultSchema, stmt.Table),
 				foreignKey: ForeignKey{
 					constraintName:    stmt.ForeignKey.ConstraintName.String(),
 					indexName:         stmt.ForeignKey.IndexName.String(),
@@ -403,7 +414,7 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 			}
 			return &AddPolicy{
 				statement: ddl,
-				tableName: normalizedTableName(mode, stmt.Table),
+				tableName: normalizedTableName(mode, defaultSchema, stmt.Table),
 				policy: Policy{
 					name:       stmt.Policy.Name.String(),
 					permissive: stmt.Policy.Permissive.Raw(),
@@ -416,7 +427,7 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 		} else if stmt.Action == sqlparser.CreateViewStr {
 			return &View{
 				statement:  ddl,
-				name:       normalizedTableName(mode, stmt.View.Name),
+				name:       normalizedTableName(mode, defaultSchema, stmt.View.Name),
 				definition: sqlparser.String(stmt.View.Definition),
 			}, nil
 		} else if stmt.Action == sqlparser.CreateTriggerStr {
@@ -435,7 +446,7 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 			}, nil
 		} else if stmt.Action == sqlparser.CreateTypeStr {
 			return &Type{
-				name:      normalizedTableName(mode, stmt.Type.Name),
+				name:      normalizedTableName(mode, defaultSchema, stmt.Type.Name),
 				statement: ddl,
 			}, nil
 		} else {
@@ -450,13 +461,26 @@ func parseDDL(mode GeneratorMode, ddl string) (DDL, error) {
 }
 
 // Parse `ddls`, which is expected to `;`-concatenated DDLs
-// and not to include destructive DDL.
-func ParseDDLs(mode GeneratorMode, str string) ([]DDL, error) {
+// and not to include destructive DDL. Unqualified names are resolved against defaultSchema in Postgres.
+func ParseDDLs(mode GeneratorMode, defaultSchema string, str string) ([]DDL, error) {
+	ddls, _, err := parseDDLsWithOffsets(mode, defaultSchema, str)
+	return ddls, err
+}
+
+var leadingSpacesAndComments = regexp.MustCompile(`^(\s|--[^\n]*)*`)
+
+// Same as ParseDDLs, but it also returns the position of each DDL in str.
+// Unqualified names are resolved against defaultSchema in Postgres.
+func parseDDLsWithOffsets(mode GeneratorMode, defaultSchema string, str string) ([]DDL, []int, error) {
 	re := regexp.MustCompilePOSIX("^--.*")
-	str = re.ReplaceAllString(str, "")
+	str = re.ReplaceAllStringFunc(str, func(comment string) string {
+		return strings.Repeat(" ", len(comment)) // keep offsets
+	})
 
 	ddls := strings.Split(str, ";")
 	result := []DDL{}
+	offsets := []int{}
+	offset := 0 // position of ddls[0] in str
 
 	for len(ddls) > 0 {
 		// Unfortunately, there's no easy way to let sqlparser recognize which ';' is the end of a DDL.
@@ -472,7 +496,7 @@ func ParseDDLs(mode GeneratorMode, str string) ([]DDL, error) {
 				break
 			}
 
-			parsed, err = parseDDL(mode, ddl)
+			parsed, err = parseDDL(mode, defaultSchema, ddl)
 			if err == nil || i == len(ddls) {
 				break
 			}
@@ -480,19 +504,67 @@ func ParseDDLs(mode GeneratorMode, str string) ([]DDL, error) {
 		}
 
 		if err != nil {
-			return result, err
+			return result, offsets, err
 		}
 		if parsed != nil {
+			ddl := strings.Join(ddls[0:i], ";")
 			result = append(result, parsed)
+			offsets = append(offsets, offset+len(leadingSpacesAndComments.FindString(ddl)))
 		}
 
 		if i < len(ddls) {
+			offset += len(strings.Join(ddls[0:i], ";")) + 1
 			ddls = ddls[i:]
 		} else {
 			break
 		}
 	}
-	return result, nil
+	return result, offsets, nil
+}
+
+var renamedAnnotation = regexp.MustCompile(`--\s*@renamed\s+from\s+(\S+)`)
+
+// Set `renamedFrom` of the table or columns with `-- @renamed from old_name` at the end of
+// the `CREATE TABLE` line or the column definition line.
+func parseRenameAnnotations(mode GeneratorMode, defaultSchema string, ddl string, table *Table) error {
+	for _, line := range strings.Split(ddl, "\n") {
+		match := renamedAnnotation.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		oldName := unquoteSQLName(line[match[2]:match[3]])
+		definition := strings.TrimSpace(line[:match[0]])
+
+		if strings.HasPrefix(strings.ToUpper(definition), "CREATE TABLE") {
+			table.renamedFrom = normalizedTable(mode, defaultSchema, oldName)
+			continue
+		}
+
+		fields := strings.Fields(definition)
+		found := false
+		if len(fields) > 0 {
+			columnName := unquoteSQLName(fields[0])
+			for i := range table.columns {
+				if table.columns[i].name == columnName {
+					table.columns[i].renamedFrom = oldName
+					found = true
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("'@renamed from %s' must be put on a line of CREATE TABLE or a column definition: '%s'", oldName, strings.TrimSpace(line))
+		}
+	}
+	return nil
+}
+
+// Remove quotes from each part of a possibly qualified name, e.g. "public"."users" -> public.users
+func unquoteSQLName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(part, "`\"[]")
+	}
+	return strings.Join(parts, ".")
 }
 
 // Replace pseudo collation "binary" with "{charset}_bin"
@@ -504,22 +576,25 @@ func normalizeCollate(collate string, table sqlparser.TableSpec) string {
 	}
 }
 
-// Qualify Postgres schema
-func normalizedTableName(mode GeneratorMode, tableName sqlparser.TableName) string {
+// Qualify Postgres schema with defaultSchema if it's omitted
+func normalizedTableName(mode GeneratorMode, defaultSchema string, tableName sqlparser.TableName) string {
 	table := tableName.Name.String()
 	if mode == GeneratorModePostgres {
 		if len(tableName.Qualifier.String()) > 0 {
 			table = tableName.Qualifier.String() + "." + table
 		} else {
-			table = "public." + table
+			table = defaultSchema + "." + table
 		}
 	}
 	return table
 }
 
-func normalizedTable(mode GeneratorMode, tableName string) string {
+func normalizedTable(mode GeneratorMode, defaultSchema string, tableName string) string {
 	if mode == GeneratorModePostgres {
 		schema, table := postgres.SplitTableName(tableName)
+		if !strings.Contains(tableName, ".") {
+			schema = defaultSchema
+		}
 		return fmt.Sprintf("%s.%s", schema, table)
 	} else {
 		return tableName
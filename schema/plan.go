@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// What a Change does to its target object
+type ChangeKind string
+
+const (
+	ChangeKindCreate = ChangeKind("create")
+	ChangeKindAlter  = ChangeKind("alter")
+	ChangeKindDrop   = ChangeKind("drop")
+	ChangeKindRename = ChangeKind("rename")
+)
+
+// Kind of schema object that a Change targets
+type ObjectType string
+
+const (
+	ObjectTypeTable      = ObjectType("table")
+	ObjectTypeColumn     = ObjectType("column")
+	ObjectTypeIndex      = ObjectType("index")
+	ObjectTypeForeignKey = ObjectType("foreign_key")
+	ObjectTypeCheck      = ObjectType("check")
+	ObjectTypeView       = ObjectType("view")
+	ObjectTypeTrigger    = ObjectType("trigger")
+	ObjectTypeType       = ObjectType("type")
+	ObjectTypePolicy     = ObjectType("policy")
+)
+
+var objectTypes = []ObjectType{
+	ObjectTypeTable, ObjectTypeColumn, ObjectTypeIndex, ObjectTypeForeignKey, ObjectTypeCheck,
+	ObjectTypeView, ObjectTypeTrigger, ObjectTypeType, ObjectTypePolicy,
+}
+
+// Parse a comma-separated list of object types such as "table,column"
+func ParseObjectTypes(list string) ([]ObjectType, error) {
+	var types []ObjectType
+	for _, name := range strings.Split(list, ",") {
+		objectType := ObjectType(strings.TrimSpace(name))
+		if !ContainsObjectType(objectTypes, objectType) {
+			names := make([]string, len(objectTypes))
+			for i, t := range objectTypes {
+				names[i] = string(t)
+			}
+			return nil, fmt.Errorf("unknown object type '%s' (expected one of: %s)", objectType, strings.Join(names, ", "))
+		}
+		types = append(types, objectType)
+	}
+	return types, nil
+}
+
+// Return true if types has objectType
+func ContainsObjectType(types []ObjectType, objectType ObjectType) bool {
+	for _, t := range types {
+		if t == objectType {
+			return true
+		}
+	}
+	return false
+}
+
+// A single DDL generated by GenerateIdempotentPlan, with what it does.
+type Change struct {
+	Kind       ChangeKind `json:"kind"`
+	ObjectType ObjectType `json:"object_type"`
+	// Table (or view / type) name the change applies to. Qualified with a schema for Postgres and MSSQL.
+	Table string `json:"table,omitempty"`
+	// Column name for ObjectTypeColumn changes
+	Column string `json:"column,omitempty"`
+	// Index, constraint, policy or trigger name if the change targets such an object
+	Name string `json:"name,omitempty"`
+	// Previous table, column or index name for ChangeKindRename
+	RenamedFrom string `json:"renamed_from,omitempty"`
+	// True if the rename is guessed by GeneratorOptions.DetectRenames and should be confirmed
+	Detected bool `json:"detected,omitempty"`
+	// True if executing the change may lose data or schema objects
+	Destructive bool   `json:"destructive"`
+	SQL         string `json:"sql"`
+	// Run instead of SQL in order when MySQL rejects its ALGORITHM=
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	// True if SQL can't run in a transaction, e.g. Postgres' CREATE INDEX CONCURRENTLY
+	NoTransaction bool `json:"no_transaction,omitempty"`
+}
+
+// Ordered list of changes to apply the desired schema to the current schema.
+type Plan []Change
+
+// Return SQL of each change in the plan
+func (p Plan) DDLs() []string {
+	ddls := make([]string, len(p))
+	for i, change := range p {
+		ddls[i] = change.SQL
+	}
+	return ddls
+}
+
+func createChange(objectType ObjectType, table string, sql string) Change {
+	return Change{Kind: ChangeKindCreate, ObjectType: objectType, Table: table, SQL: sql}
+}
+
+func alterChange(objectType ObjectType, table string, sql string) Change {
+	return Change{Kind: ChangeKindAlter, ObjectType: objectType, Table: table, SQL: sql}
+}
+
+func renameChange(objectType ObjectType, table string, renamedFrom string, sql string) Change {
+	return Change{Kind: ChangeKindRename, ObjectType: objectType, Table: table, RenamedFrom: renamedFrom, SQL: sql}
+}
+
+func dropChange(objectType ObjectType, table string, sql string) Change {
+	return Change{Kind: ChangeKindDrop, ObjectType: objectType, Table: table, Destructive: true, SQL: sql}
+}
+
+func (c Change) withColumn(column string) Change {
+	c.Column = column
+	return c
+}
+
+func (c Change) withName(name string) Change {
+	c.Name = name
+	return c
+}
+
+func (c Change) withDetected() Change {
+	c.Detected = true
+	return c
+}
+
+// Override the default of the kind, e.g. for a drop followed by re-creation, or a narrowing alter
+func (c Change) withDestructive(destructive bool) Change {
+	c.Destructive = destructive
+	return c
+}
@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A file concatenated into the desired SQL, used to show where a DDL is defined
+type SourceFile struct {
+	Name   string
+	Offset int // Position of the file content in the desired SQL
+}
+
+// Key of a desired object to find where it's defined
+type objectKey struct {
+	objectType ObjectType
+	table      string
+	name       string
+}
+
+// Return "file:line" of the offset in the desired SQL, or "line N" if files are unknown.
+func (g *Generator) location(offset int) string {
+	file := SourceFile{Offset: 0}
+	for _, f := range g.options.DesiredFiles {
+		if f.Offset <= offset {
+			file = f
+		}
+	}
+	if offset > len(g.desiredSQL) {
+		offset = len(g.desiredSQL)
+	}
+	line := strings.Count(g.desiredSQL[file.Offset:offset], "\n") + 1
+
+	if file.Name == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", file.Name, line)
+}
+
+// Remember that the object is defined by the DDL being examined
+func (g *Generator) defineDesired(key objectKey) {
+	if _, ok := g.desiredLocations[key]; !ok {
+		g.desiredLocations[key] = g.desiredOffset
+	}
+}
+
+// Describe where a doubly created object is defined for errors
+func (g *Generator) doublyCreatedAt(key objectKey) string {
+	return fmt.Sprintf("defined at %s and %s", g.location(g.desiredLocations[key]), g.location(g.desiredOffset))
+}
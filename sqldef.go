@@ -1,66 +1,435 @@
 package sqldef
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/k0kubun/sqldef/adapter"
 	"github.com/k0kubun/sqldef/schema"
 )
 
 type Options struct {
-	DesiredFile string
+	DesiredFile string           // A file, a directory, or a glob pattern
+	DesiredDDLs string           // Used instead of reading DesiredFile if not empty
+	DesiredDB   adapter.Database // Dumped as the desired schema instead of reading DesiredFile if not nil
 	CurrentFile string
 	DryRun      bool
+	Check       bool // Same as DryRun, but Run exits with 2 if there are DDLs to apply
 	Export      bool
-	SkipDrop    bool
-	BeforeApply string
+	ConvertTo   string // Dialect to convert the desired schema to by Convert
+	SkipDrop    bool   // Skip all destructive changes
+	// Skip destructive changes to the object types
+	SkipDropTypes []schema.ObjectType
+	// Skip destructive changes to object types other than these if not empty
+	AllowDropTypes []schema.ObjectType
+	BeforeApply    string
+	Timeout        time.Duration // No timeout if zero
+	PlanOut        string        // Write the plan to the file instead of applying it
+	ApplyPlan      string        // Apply the plan in the file instead of reading DesiredFile
+	DetectRenames  bool          // Propose renames of columns and indexes instead of dropping and adding them
+	Interactive    bool          // Ask whether to run each DDL by reading Runner.In
+	Transaction    string        // "auto", "single" or "none". "auto" if empty.
+	Resume         string        // File recording DDLs applied before a failure to continue from the failed one
+	// Set before each DDL to limit how long it waits for locks and runs. Not set if zero.
+	LockTimeout      time.Duration
+	StatementTimeout time.Duration
+	// Retry a DDL failing by LockTimeout up to this count, waiting 1s, 2s, 4s, ... in between
+	LockRetries int
+	// Patterns of objects to manage, which are globs, /regexp/ or @file. Everything is managed if empty.
+	Include []string
+	// Patterns of objects to be ignored
+	Exclude []string
+	// Only Postgres
+	Schemas       []string // Schemas to manage. All schemas if empty.
+	DefaultSchema string   // Schema of unqualified names in the desired schema. "public" if empty.
+	Concurrently  bool     // Run CREATE INDEX and DROP INDEX CONCURRENTLY outside the transaction
+	// Only MySQL
+	Algorithms []string // ALGORITHM= of ALTER TABLE tried in order
+	Lock       string   // LOCK= of ALTER TABLE
+	// ALTER TABLE of large tables is converted to commands of gh-ost or pt-online-schema-change if not nil
+	OnlineSchemaChange *OnlineSchemaChange
+}
+
+// Outcome of Runner.Run
+type Result struct {
+	// Dumped schema of the current database
+	CurrentDDLs string
+	// Changes required to reach the desired schema. Empty if nothing is modified.
+	Plan schema.Plan
+	// True if the plan was executed against the database
+	Applied bool
+	// True if the plan has DDLs that are neither applied nor skipped
+	Pending bool
+}
+
+// Library entry point to run sqldef without exiting the process.
+// Everything that the commands print to stdout is written to Out.
+type Runner struct {
+	GeneratorMode schema.GeneratorMode
+	DB            adapter.Database
+	Options       Options
+	Out           io.Writer
+	In            io.Reader // Answers to the questions of Options.Interactive
+
+	tempFiles []string // Removed at the end of Run
+}
+
+func NewRunner(generatorMode schema.GeneratorMode, db adapter.Database, options Options, out io.Writer) *Runner {
+	return &Runner{
+		GeneratorMode: generatorMode,
+		DB:            db,
+		Options:       options,
+		Out:           out,
+	}
 }
 
 // Main function shared by `mysqldef` and `psqldef`
 func Run(generatorMode schema.GeneratorMode, db adapter.Database, options *Options) {
-	currentDDLs, err := adapter.DumpDDLs(db)
+	ctx := context.Background()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	runner := NewRunner(generatorMode, db, *options, os.Stdout)
+	if options.Interactive {
+		in, closeInput, err := interactiveInput(options)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer closeInput()
+		runner.In = in
+	}
+	result, err := runner.Run(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if options.Check && result.Pending {
+		os.Exit(2)
+	}
+}
+
+// Print the desired schema converted to the dialect of options.ConvertTo without connecting to a database.
+// Constructs which can't be converted are reported to stderr.
+func Convert(generatorMode schema.GeneratorMode, options *Options) {
+	if err := convert(generatorMode, options, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func convert(generatorMode schema.GeneratorMode, options *Options, out io.Writer, errOut io.Writer) error {
+	to, err := schema.ParseGeneratorMode(options.ConvertTo)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Error on DumpDDLs: %s", err))
+		return err
+	}
+	sql, _, err := ReadFiles(options.DesiredFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read '%s': %w", options.DesiredFile, err)
 	}
 
+	ddls, unmapped, err := schema.ConvertDDLs(generatorMode, to, sql)
+	if err != nil {
+		return err
+	}
+	for _, ddl := range ddls {
+		fmt.Fprintf(out, "%s;\n", ddl)
+	}
+	for _, message := range unmapped {
+		fmt.Fprintf(errOut, "-- Not converted: %s\n", message)
+	}
+	return nil
+}
+
+func (r *Runner) Run(ctx context.Context) (*Result, error) {
+	defer r.removeTempFiles()
+	out := r.Out
+	if out == nil {
+		out = ioutil.Discard
+	}
+	options := r.Options
+	result := &Result{}
+
+	noTransaction, err := options.noTransaction(r.GeneratorMode)
+	if err != nil {
+		return nil, err
+	}
+	if options.Interactive && !noTransaction {
+		return nil, fmt.Errorf("--interactive requires --transaction=none, not to hold locks of a transaction while waiting for answers")
+	}
+	if options.LockRetries > 0 && options.LockTimeout == 0 {
+		return nil, fmt.Errorf("--lock-retries requires --lock-timeout, without which a DDL never fails by a lock timeout")
+	}
+	filter, err := options.filter()
+	if err != nil {
+		return nil, err
+	}
+	dumpFilter := filter
+	if options.CurrentFile != "" {
+		dumpFilter = nil // "tables" of the file adapter are files
+	}
+
+	currentDDLs, err := adapter.DumpFilteredDDLs(ctx, r.DB, dumpFilter)
+	if err != nil {
+		return nil, fmt.Errorf("Error on DumpDDLs: %w", err)
+	}
+	result.CurrentDDLs = currentDDLs
+
 	if options.Export {
 		if currentDDLs == "" {
-			fmt.Printf("-- No table exists --\n")
+			fmt.Fprintf(out, "-- No table exists --\n")
 		} else {
-			fmt.Printf("%s\n", currentDDLs)
+			fmt.Fprintf(out, "%s\n", currentDDLs)
 		}
-		return
+		return result, nil
+	}
+
+	if options.ApplyPlan != "" {
+		return r.applyPlanFile(ctx, result)
 	}
 
-	sql, err := ReadFile(options.DesiredFile)
+	desiredDDLs := options.DesiredDDLs
+	var desiredFiles []schema.SourceFile
+	defaultSchema := options.DefaultSchema
+	if options.DesiredDB != nil {
+		desiredDDLs, err = adapter.DumpFilteredDDLs(ctx, options.DesiredDB, filter)
+		if err != nil {
+			return nil, fmt.Errorf("Error on DumpDDLs of the desired database: %w", err)
+		}
+		defaultSchema = "" // unqualified names are dumped only in "public"
+	} else if desiredDDLs == "" {
+		sql, files, err := ReadFiles(options.DesiredFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read '%s': %w", options.DesiredFile, err)
+		}
+		desiredDDLs = sql
+		desiredFiles = files
+	}
+
+	plan, err := schema.GenerateIdempotentPlan(r.GeneratorMode, desiredDDLs, currentDDLs, schema.GeneratorOptions{
+		DetectRenames:     options.DetectRenames,
+		DesiredFiles:      desiredFiles,
+		Filter:            filter,
+		Schemas:           options.Schemas,
+		DefaultSchema:     defaultSchema,
+		Algorithms:        options.Algorithms,
+		Lock:              options.Lock,
+		ConcurrentIndexes: options.Concurrently,
+	})
 	if err != nil {
-		log.Fatalf("Failed to read '%s': %s", options.DesiredFile, err)
+		return nil, err
+	}
+	result.Plan = plan
+	if options.PlanOut != "" {
+		if err := writePlanFile(options.PlanOut, currentDDLs, plan, options); err != nil {
+			return result, fmt.Errorf("Failed to write '%s': %w", options.PlanOut, err)
+		}
+	}
+
+	if len(plan) == 0 {
+		fmt.Fprintln(out, "-- Nothing is modified --")
+		return result, nil
 	}
-	desiredDDLs := sql
 
-	ddls, err := schema.GenerateIdempotentDDLs(generatorMode, desiredDDLs, currentDDLs)
+	ddls, positions, resumeFile, err := r.prepareDDLs(ctx, plan, buildDDLs(plan, options), out)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return result, err
+	}
+	if options.DryRun || options.Check || options.PlanOut != "" || len(options.CurrentFile) > 0 {
+		showDDLs(out, ddls, options.BeforeApply)
+		result.Pending = hasUnskippedDDLs(ddls)
+		return result, nil
+	}
+
+	err = r.runDDLs(ctx, plan, ddls, positions, options.BeforeApply, resumeFile, out)
+	if err != nil {
+		return result, err
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// Execute a plan written by --plan-out if the current schema is unchanged since then
+func (r *Runner) applyPlanFile(ctx context.Context, result *Result) (*Result, error) {
+	out := r.Out
+	if out == nil {
+		out = ioutil.Discard
+	}
+
+	planFile, err := readPlanFile(r.Options.ApplyPlan)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read '%s': %w", r.Options.ApplyPlan, err)
+	}
+	if fingerprint := Fingerprint(result.CurrentDDLs); fingerprint != planFile.Fingerprint {
+		return nil, fmt.Errorf("The current schema has changed since '%s' was generated (expected %s, got %s)",
+			r.Options.ApplyPlan, planFile.Fingerprint, fingerprint)
+	}
+	result.Plan = planFile.Changes
+
+	if len(planFile.Changes) == 0 {
+		fmt.Fprintln(out, "-- Nothing is modified --")
+		return result, nil
+	}
+
+	// Changes to skip were already excluded by --plan-out
+	ddls, positions, resumeFile, err := r.prepareDDLs(ctx, planFile.Changes, buildDDLs(planFile.Changes, Options{}), out)
+	if err != nil {
+		return result, err
+	}
+	if r.Options.DryRun || r.Options.Check {
+		showDDLs(out, ddls, planFile.BeforeApply)
+		result.Pending = hasUnskippedDDLs(ddls)
+		return result, nil
 	}
-	if len(ddls) == 0 {
-		fmt.Println("-- Nothing is modified --")
-		return
+
+	err = r.runDDLs(ctx, planFile.Changes, ddls, positions, planFile.BeforeApply, resumeFile, out)
+	if err != nil {
+		return result, err
 	}
+	result.Applied = true
+	return result, nil
+}
 
-	if options.DryRun || len(options.CurrentFile) > 0 {
-		showDDLs(ddls, options.SkipDrop, options.BeforeApply)
-		return
+// Convert DDLs of the plan by Options.OnlineSchemaChange, skip DDLs applied before the failure recorded in
+// Options.Resume, and prepend drops of invalid indexes left by a failed Options.Concurrently.
+// It also returns the positions of the DDLs in the planned ones, which are -1 for the drops.
+func (r *Runner) prepareDDLs(ctx context.Context, plan schema.Plan, ddls []adapter.DDL, out io.Writer) ([]adapter.DDL, []int, *ResumeFile, error) {
+	var err error
+	if r.Options.OnlineSchemaChange != nil {
+		if ddls, err = r.onlineSchemaChangeDDLs(ctx, ddls, plan); err != nil {
+			return nil, nil, nil, err
+		}
 	}
+	positions := make([]int, len(ddls))
+	for i := range positions {
+		positions[i] = i
+	}
+	var resumeFile *ResumeFile
+	if r.Options.Resume != "" {
+		if resumeFile, err = readResumeFile(r.Options.Resume); err != nil {
+			return nil, nil, nil, fmt.Errorf("Failed to read '%s': %w", r.Options.Resume, err)
+		}
+		if resumeFile != nil {
+			if ddls, positions, err = resumeFile.resume(ddls, out); err != nil {
+				return nil, nil, nil, fmt.Errorf("Failed to resume by '%s': %w", r.Options.Resume, err)
+			}
+		}
+	}
+	if r.Options.Concurrently {
+		drops, err := r.invalidIndexDrops(ctx, plan)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		dropPositions := make([]int, len(drops))
+		for i := range dropPositions {
+			dropPositions[i] = -1
+		}
+		ddls = append(drops, ddls...)
+		positions = append(dropPositions, positions...)
+	}
+	return ddls, positions, resumeFile, nil
+}
 
-	err = adapter.RunDDLs(db, ddls, options.SkipDrop, options.BeforeApply)
+// Wait before the first retry of a DDL failing by a lock timeout, which is doubled for each retry
+const lockRetryBackoff = time.Second
+
+// Run DDLs against the database. When a DDL fails, it reports which DDLs were applied,
+// and records them to Options.Resume with the last resumeFile and their positions in the planned DDLs.
+func (r *Runner) runDDLs(ctx context.Context, plan schema.Plan, ddls []adapter.DDL, positions []int, beforeApply string, resumeFile *ResumeFile, out io.Writer) error {
+	noTransaction, err := r.Options.noTransaction(r.GeneratorMode)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	confirm, err := r.confirm(out)
+	if err != nil {
+		return err
+	}
+
+	err = adapter.RunDDLs(ctx, r.DB, ddls, adapter.RunOptions{
+		BeforeApply:      beforeApply,
+		NoTransaction:    noTransaction,
+		Confirm:          confirm,
+		LockTimeout:      r.Options.LockTimeout,
+		StatementTimeout: r.Options.StatementTimeout,
+		LockRetries:      r.Options.LockRetries,
+		RetryBackoff:     lockRetryBackoff,
+	}, out)
+	var runErr *adapter.RunError
+	if !errors.As(err, &runErr) {
+		if err == nil && resumeFile != nil {
+			if err := os.Remove(r.Options.Resume); err != nil {
+				return err
+			}
+		}
+		return err
 	}
+
+	reportFailure(out, runErr, r.GeneratorMode)
+	if r.Options.Concurrently && runErr.Failed.NoTransaction {
+		if err := r.dropInvalidIndexes(ctx, plan, out); err != nil {
+			fmt.Fprintf(out, "-- %s --\n", err)
+		}
+	}
+	if r.Options.Resume != "" {
+		if resumeFile == nil {
+			resumeFile = &ResumeFile{Applied: []AppliedDDL{}}
+		}
+		resumeFile.Applied = append(resumeFile.Applied, appliedDDLs(ddls, positions, runErr.Applied)...)
+		resumeFile.Failed = runErr.Failed.SQL
+		if err := writeResumeFile(r.Options.Resume, resumeFile); err != nil {
+			return fmt.Errorf("Failed to write '%s': %w", r.Options.Resume, err)
+		}
+		fmt.Fprintf(out, "-- Run again with --resume=%s to continue from the failed statement --\n", r.Options.Resume)
+	}
+	return err
+}
+
+func reportFailure(out io.Writer, err *adapter.RunError, generatorMode schema.GeneratorMode) {
+	if err.Failed.SQL == "" {
+		fmt.Fprintln(out, "-- Failed to commit --")
+	} else {
+		fmt.Fprintf(out, "-- Failed: %s\n", err.Failed.Statement())
+	}
+
+	switch {
+	case err.RolledBack && generatorMode == schema.GeneratorModeMysql:
+		fmt.Fprintln(out, "-- Rolled back, but MySQL may have committed the DDLs before the failure implicitly --")
+	case err.RolledBack:
+		fmt.Fprintln(out, "-- Rolled back. Nothing is applied. --")
+	case len(err.Applied) == 0:
+		fmt.Fprintln(out, "-- Nothing is applied --")
+	default:
+		fmt.Fprintf(out, "-- %d statement(s) were applied before the failure --\n", len(err.Applied))
+		for _, ddl := range err.Applied {
+			fmt.Fprintf(out, "-- Applied: %s\n", ddl.Statement())
+		}
+	}
+}
+
+func (r *Runner) removeTempFiles() {
+	for _, file := range r.tempFiles {
+		os.Remove(file)
+	}
+	r.tempFiles = nil
+}
+
+// Return the adapter.Confirm of Options.Interactive, or nil to run DDLs without asking
+func (r *Runner) confirm(out io.Writer) (adapter.Confirm, error) {
+	if !r.Options.Interactive {
+		return nil, nil
+	}
+	if r.In == nil {
+		return nil, fmt.Errorf("Runner.In is required for Options.Interactive")
+	}
+	return interactiveConfirm(r.In, out), nil
 }
 
 // TODO: Warn if both the second --file and database options are specified
@@ -102,16 +471,124 @@ func ReadFile(filepath string) (string, error) {
 	return string(buf), nil
 }
 
-func showDDLs(ddls []string, skipDrop bool, beforeApply string) {
-	fmt.Println("-- dry run --")
+// Set the drop options from values of --skip-drop and --allow-drop, which are empty if not given.
+// "all" is given to --skip-drop when it has no value.
+func (o *Options) ParseDropOptions(skipDrop string, allowDrop string) error {
+	var err error
+	if skipDrop == "all" {
+		o.SkipDrop = true
+	} else if skipDrop != "" {
+		if o.SkipDropTypes, err = schema.ParseObjectTypes(skipDrop); err != nil {
+			return fmt.Errorf("invalid --skip-drop: %w", err)
+		}
+	}
+	if allowDrop != "" {
+		if o.AllowDropTypes, err = schema.ParseObjectTypes(allowDrop); err != nil {
+			return fmt.Errorf("invalid --allow-drop: %w", err)
+		}
+	}
+	return nil
+}
+
+// Set the MySQL options from values of --algorithm and --lock, which are empty if not given
+func (o *Options) ParseAlterOptions(algorithm string, lock string) error {
+	var err error
+	if algorithm != "" {
+		if o.Algorithms, err = schema.ParseAlgorithms(algorithm); err != nil {
+			return fmt.Errorf("invalid --algorithm: %w", err)
+		}
+	}
+	if lock != "" {
+		if o.Lock, err = schema.ParseLock(lock); err != nil {
+			return fmt.Errorf("invalid --lock: %w", err)
+		}
+	}
+	return nil
+}
+
+// Return true if DDLs should be run one by one without a transaction for Options.Transaction
+func (o Options) noTransaction(generatorMode schema.GeneratorMode) (bool, error) {
+	switch o.Transaction {
+	case "", "auto":
+		return generatorMode == schema.GeneratorModeMysql, nil // MySQL commits each DDL implicitly
+	case "single":
+		return false, nil
+	case "none":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid --transaction '%s' (expected one of: auto, single, none)", o.Transaction)
+	}
+}
+
+// Return true if the change should not be applied with the options
+func (o Options) skips(change schema.Change) bool {
+	if !change.Destructive {
+		return false
+	}
+	if o.SkipDrop || schema.ContainsObjectType(o.SkipDropTypes, change.ObjectType) {
+		return true
+	}
+	return len(o.AllowDropTypes) > 0 && !schema.ContainsObjectType(o.AllowDropTypes, change.ObjectType)
+}
+
+func buildDDLs(plan schema.Plan, options Options) []adapter.DDL {
+	ddls := make([]adapter.DDL, len(plan))
+	type object struct {
+		objectType          schema.ObjectType
+		table, column, name string
+	}
+	skippedObjects := map[object]bool{}
+	for i, change := range plan {
+		object := object{objectType: change.ObjectType, table: change.Table, column: change.Column, name: change.Name}
+		skip := options.skips(change)
+		if skip {
+			skippedObjects[object] = true
+		} else if change.Kind == schema.ChangeKindCreate && skippedObjects[object] {
+			skip = true // the object to be re-created is not dropped, e.g. MSSQL's IDENTITY change
+		}
+		ddls[i] = adapter.DDL{SQL: change.SQL, Skip: skip, Destructive: change.Destructive, Fallbacks: change.Fallbacks,
+			NoTransaction: change.NoTransaction}
+		if change.Detected {
+			ddls[i].Comment = fmt.Sprintf("Detected rename of %s '%s' to '%s'. Make sure it's not dropped and added.",
+				change.ObjectType, change.RenamedFrom, renamedTo(change))
+		}
+	}
+	return ddls
+}
+
+func hasUnskippedDDLs(ddls []adapter.DDL) bool {
+	for _, ddl := range ddls {
+		if !ddl.Skip || ddl.Command != nil { // commands are skipped to be run by the user
+			return true
+		}
+	}
+	return false
+}
+
+func renamedTo(change schema.Change) string {
+	switch change.ObjectType {
+	case schema.ObjectTypeColumn:
+		return change.Column
+	case schema.ObjectTypeTable:
+		return change.Table
+	default:
+		return change.Name
+	}
+}
+
+func showDDLs(out io.Writer, ddls []adapter.DDL, beforeApply string) {
+	fmt.Fprintln(out, "-- dry run --")
 	if len(beforeApply) > 0 {
-		fmt.Println(beforeApply)
+		fmt.Fprintln(out, beforeApply)
 	}
 	for _, ddl := range ddls {
-		if skipDrop && strings.Contains(ddl, "DROP") {
-			fmt.Printf("-- Skipped: %s;\n", ddl)
+		if len(ddl.Comment) > 0 {
+			fmt.Fprintf(out, "-- %s\n", ddl.Comment)
+		}
+		if ddl.Skip {
+			fmt.Fprintf(out, "-- Skipped: %s\n", ddl.Statement())
 			continue
 		}
-		fmt.Printf("%s;\n", ddl)
+		fmt.Fprintln(out, ddl.Statement())
 	}
 }